@@ -0,0 +1,308 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// scopeReadOnly only allows safe (GET, HEAD and OPTIONS) requests
+	scopeReadOnly = "ro"
+	// scopeReadWrite allows all requests
+	scopeReadWrite = "rw"
+)
+
+type identityKey struct{}
+
+// Identity is an authenticated caller and the access it's been granted
+type Identity struct {
+	// Name identifies the caller, ie. the name of the token or the subject of a JWT or client certificate
+	Name string
+	// Access is the list of access granted to the caller, a request is allowed if any of them allow it
+	Access []Access
+}
+
+// Access allows requests to a set of hosts and object types
+type Access struct {
+	// Hosts are the LTM hosts that can be accessed, "*" allows all hosts
+	Hosts []string
+	// Objects are the object types that can be accessed, "*" allows all types
+	Objects []string
+	// Scope is "ro" for read-only access or "rw" for read-write access
+	Scope string
+}
+
+// fullAccess allows all requests
+var fullAccess = Access{Hosts: []string{"*"}, Objects: []string{"*"}, Scope: scopeReadWrite}
+
+// apiToken is a named pre-shared key and the identity it authenticates
+type apiToken struct {
+	psk      []byte
+	identity *Identity
+}
+
+// authenticator identifies the caller of a request from a verified client certificate, from
+// an 'Authorization: Bearer' token when JWT authentication is configured, or from the
+// X-Auth-Token header
+type authenticator struct {
+	tokens  []apiToken
+	jwt     *jwtAuthenticator
+	clients map[string]Access
+	cache   *tokenCache
+	limiter *failureLimiter
+}
+
+// authenticate returns the identity of the caller
+func (a *authenticator) authenticate(r *http.Request) (*Identity, error) {
+	if identity, ok := clientCertIdentity(r.TLS, a.clients); ok {
+		return identity, nil
+	}
+
+	if bearer, ok := bearerToken(r); ok && a.jwt != nil {
+		return a.jwt.authenticate(bearer)
+	}
+
+	htoken := []byte(r.Header.Get("X-Auth-Token"))
+	if identity, ok := a.cache.get(htoken); ok {
+		return identity, nil
+	}
+
+	for _, t := range a.tokens {
+		if err := bcrypt.CompareHashAndPassword(htoken, t.psk); err == nil {
+			a.cache.put(htoken, t.identity)
+			return t.identity, nil
+		}
+	}
+
+	return nil, apierror.New(apierror.ErrForbidden, "unable to authenticate session", nil)
+}
+
+// verified returns the identity of the caller from a verified client certificate or a cached
+// X-Auth-Token, without checking the token against the configured tokens
+func (a *authenticator) verified(r *http.Request) (*Identity, bool) {
+	if identity, ok := clientCertIdentity(r.TLS, a.clients); ok {
+		return identity, true
+	}
+
+	if _, ok := bearerToken(r); ok && a.jwt != nil {
+		return nil, false
+	}
+
+	return a.cache.get([]byte(r.Header.Get("X-Auth-Token")))
+}
+
+// bearerToken returns the token from an 'Authorization: Bearer' header
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return "", false
+	}
+
+	return strings.TrimSpace(h[7:]), true
+}
+
+// newAPITokens creates the list of api tokens from the configuration.  The shared token is given
+// full access with the name 'default', named tokens are sorted by name.
+func newAPITokens(config common.Config) ([]apiToken, error) {
+	tokens := []apiToken{}
+
+	clientCerts := config.TLS != nil && len(config.TLS.Clients) > 0
+	if config.Token != "" || (len(config.Tokens) == 0 && config.OIDC == nil && !clientCerts) {
+		tokens = append(tokens, apiToken{
+			psk:      []byte(config.Token),
+			identity: &Identity{Name: "default", Access: []Access{fullAccess}},
+		})
+	}
+
+	names := make([]string, 0, len(config.Tokens))
+	for name := range config.Tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := config.Tokens[name]
+		if t.Token == "" {
+			return nil, fmt.Errorf("token %s has an empty token", name)
+		}
+
+		access, err := newAccess(t.AccessConfig)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %s", name, err)
+		}
+
+		tokens = append(tokens, apiToken{
+			psk:      []byte(t.Token),
+			identity: &Identity{Name: name, Access: []Access{access}},
+		})
+	}
+
+	return tokens, nil
+}
+
+// newAccess creates the access from the configuration, the default scope is read-only
+func newAccess(config common.AccessConfig) (Access, error) {
+	scope := config.Scope
+	if scope == "" {
+		scope = scopeReadOnly
+	}
+
+	if scope != scopeReadOnly && scope != scopeReadWrite {
+		return Access{}, fmt.Errorf("invalid scope %q, must be one of '%s' or '%s'", config.Scope, scopeReadOnly, scopeReadWrite)
+	}
+
+	return Access{
+		Hosts:   config.Hosts,
+		Objects: config.Objects,
+		Scope:   scope,
+	}, nil
+}
+
+// withIdentity returns a copy of the context carrying the identity
+func withIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// identity returns the authenticated identity from the context, or nil for public requests
+func identity(ctx context.Context) *Identity {
+	if i, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return i
+	}
+	return nil
+}
+
+// identityName returns the name of the authenticated identity from the context, or "anonymous"
+func identityName(ctx context.Context) string {
+	if i := identity(ctx); i != nil {
+		return i.Name
+	}
+	return "anonymous"
+}
+
+// authorize returns an error if the identity isn't allowed to make a request with the method to
+// the object type on the host.  Requests that aren't for a host only check the object type.
+func (i *Identity) authorize(method, host, object string) error {
+	for _, a := range i.Access {
+		if a.allows(method, host, object) {
+			return nil
+		}
+	}
+
+	target := object
+	if host != "" {
+		target = fmt.Sprintf("%s on host %s", object, host)
+	}
+
+	return apierror.New(apierror.ErrForbidden, fmt.Sprintf("%s is not allowed to %s %s", i.Name, method, target), nil)
+}
+
+// allows returns true if the access allows a request with the method to the object type on the host
+func (a Access) allows(method, host, object string) bool {
+	if host != "" && !matchAny(a.Hosts, host) {
+		return false
+	}
+
+	if object != "" && !matchAny(a.Objects, object) {
+		return false
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return a.Scope == scopeReadWrite
+}
+
+// allowsHost returns true if the caller of the request can read the route's object type on the
+// host.  It's used to filter the results of routes that aren't for a single host, ie. the jobs
+// and audit events of every host.  Requests without an identity are public and have already been
+// let through by the token middleware.
+func allowsHost(r *http.Request, host string) bool {
+	i := identity(r.Context())
+	if i == nil {
+		return true
+	}
+
+	object := routeObject(r)
+	for _, a := range i.Access {
+		if a.allows(http.MethodGet, host, object) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ScopeMiddleware is a router middleware that checks the authenticated identity is allowed to
+// access the route's host and object type with the request method.  It must run after the
+// route is matched, so it's added with router.Use.  Requests without an identity are public
+// and have already been let through by the token middleware.
+func ScopeMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := identity(r.Context())
+		if i == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		host := mux.Vars(r)["host"]
+		object := routeObject(r)
+
+		if err := i.authorize(r.Method, host, object); err != nil {
+			log.Warnf("denied %s %s for %s", r.Method, r.URL.Path, i.Name)
+			handleError(w, err)
+			return
+		}
+
+		log.Debugf("authorized %s %s for %s", r.Method, r.URL.Path, i.Name)
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// routeObject returns the object type of the matched route, ie. 'clientssl' for
+// /v1/f5/{host}/createclientssl/{name} and 'jobs' for /v1/f5/jobs/{id}
+func routeObject(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+
+	for _, part := range strings.Split(tpl, "/") {
+		switch part {
+		case "", "v1", "v2", "f5", "{host}":
+			continue
+		}
+
+		part = strings.TrimPrefix(part, "create")
+		part = strings.TrimPrefix(part, "update")
+		return part
+	}
+
+	return ""
+}
+
+// matchAny returns true if the value is in the list, or the list contains "*"
+func matchAny(list []string, value string) bool {
+	for _, v := range list {
+		if v == "*" || v == value {
+			return true
+		}
+	}
+	return false
+}
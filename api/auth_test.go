@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/audit"
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/job"
+	"github.com/YaleSpinup/f5-api/ltm"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewAPITokens(t *testing.T) {
+	tokens, err := newAPITokens(common.Config{
+		Token: "shared",
+		Tokens: map[string]common.TokenConfig{
+			"portal": {
+				Token:        "portal-token",
+				AccessConfig: common.AccessConfig{Hosts: []string{"ltm1.example.org"}, Objects: []string{"clientssl"}, Scope: "rw"},
+			},
+			"monitor": {
+				Token:        "monitor-token",
+				AccessConfig: common.AccessConfig{Hosts: []string{"*"}, Objects: []string{"*"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(tokens) != 3 {
+		t.Fatalf("expected 3 tokens, got %d", len(tokens))
+	}
+
+	for i, name := range []string{"default", "monitor", "portal"} {
+		if tokens[i].identity.Name != name {
+			t.Errorf("expected token %d to be %s, got %s", i, name, tokens[i].identity.Name)
+		}
+	}
+
+	if tokens[1].identity.Access[0].Scope != scopeReadOnly {
+		t.Errorf("expected default scope %s, got %s", scopeReadOnly, tokens[1].identity.Access[0].Scope)
+	}
+
+	// without a shared token only the named tokens are used
+	tokens, err = newAPITokens(common.Config{
+		Tokens: map[string]common.TokenConfig{"portal": {Token: "portal-token"}},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(tokens) != 1 || tokens[0].identity.Name != "portal" {
+		t.Errorf("expected only the portal token, got %+v", tokens)
+	}
+
+	for _, bad := range []common.TokenConfig{{Token: ""}, {Token: "x", AccessConfig: common.AccessConfig{Scope: "admin"}}} {
+		if _, err := newAPITokens(common.Config{Tokens: map[string]common.TokenConfig{"bad": bad}}); err == nil {
+			t.Errorf("expected error for token %+v", bad)
+		}
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	tokens := []apiToken{
+		{
+			psk:      []byte("portal-token"),
+			identity: &Identity{Name: "portal", Access: []Access{{Hosts: []string{"ltm1.example.org"}, Objects: []string{"clientssl"}, Scope: scopeReadWrite}}},
+		},
+		{
+			psk:      []byte("monitor-token"),
+			identity: &Identity{Name: "monitor", Access: []Access{{Hosts: []string{"*"}, Objects: []string{"*"}, Scope: scopeReadOnly}}},
+		},
+	}
+
+	var gotIdentity string
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		gotIdentity = identity(r.Context()).Name
+		w.WriteHeader(http.StatusOK)
+	}
+
+	router := mux.NewRouter()
+	router.Use(ScopeMiddleware)
+	api := router.PathPrefix("/v1/f5").Subrouter()
+	api.HandleFunc("/jobs", ok).Methods(http.MethodGet)
+	api.HandleFunc("/{host}/clientssl/{name}", ok).Methods(http.MethodGet, http.MethodDelete)
+	api.HandleFunc("/{host}/createclientssl/{name}", ok).Methods(http.MethodPut)
+
+	srv := httptest.NewServer(tokenMiddleware(&authenticator{tokens: tokens}, map[string]string{}, router))
+	defer srv.Close()
+
+	hash := func(psk string) string {
+		h, err := bcrypt.GenerateFromPassword([]byte(psk), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(h)
+	}
+	portal, monitor := hash("portal-token"), hash("monitor-token")
+
+	tests := []struct {
+		token  string
+		method string
+		path   string
+		status int
+		name   string
+	}{
+		{portal, http.MethodGet, "/v1/f5/ltm1.example.org/clientssl/foo", http.StatusOK, "portal"},
+		{portal, http.MethodPut, "/v1/f5/ltm1.example.org/createclientssl/foo", http.StatusOK, "portal"},
+		{portal, http.MethodDelete, "/v1/f5/ltm1.example.org/clientssl/foo", http.StatusOK, "portal"},
+		{portal, http.MethodGet, "/v1/f5/ltm2.example.org/clientssl/foo", http.StatusForbidden, ""},
+		{portal, http.MethodGet, "/v1/f5/jobs", http.StatusForbidden, ""},
+		{monitor, http.MethodGet, "/v1/f5/ltm2.example.org/clientssl/foo", http.StatusOK, "monitor"},
+		{monitor, http.MethodGet, "/v1/f5/jobs", http.StatusOK, "monitor"},
+		{monitor, http.MethodDelete, "/v1/f5/ltm2.example.org/clientssl/foo", http.StatusForbidden, ""},
+		{hash("wrong-token"), http.MethodGet, "/v1/f5/jobs", http.StatusForbidden, ""},
+	}
+
+	for _, test := range tests {
+		gotIdentity = ""
+
+		req, err := http.NewRequest(test.method, srv.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Auth-Token", test.token)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != test.status {
+			t.Errorf("expected %d for %s %s, got %d", test.status, test.method, test.path, resp.StatusCode)
+		}
+
+		if gotIdentity != test.name {
+			t.Errorf("expected identity %q for %s %s, got %q", test.name, test.method, test.path, gotIdentity)
+		}
+	}
+}
+
+func TestHostScopedResults(t *testing.T) {
+	jobs, err := job.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auditLog, err := audit.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]string{}
+	for _, host := range []string{"ltm1.example.org", "ltm2.example.org"} {
+		j, err := jobs.Start(context.TODO(), "deleteclientssl", host, "www.example.org", func(ctx context.Context, tr *job.Tracker) (interface{}, error) {
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[host] = j.ID
+
+		auditLog.Record(audit.Event{Time: time.Now(), Host: host, Object: "www.example.org", Operation: "deleteclientssl"})
+	}
+
+	s := server{
+		router:  mux.NewRouter(),
+		context: context.TODO(),
+		LTMServices: map[string]ltm.LTMIface{
+			"ltm1.example.org": newMockLTM(t),
+			"ltm2.example.org": newMockLTM(t),
+		},
+		hosts: newHostMonitor(map[string]string{"ltm1.example.org": "ltm1.example.org", "ltm2.example.org": "ltm2.example.org"}),
+		jobs:  jobs,
+		audit: auditLog,
+	}
+	s.router.Use(ScopeMiddleware)
+	s.routes()
+
+	// the caller can only access ltm1
+	portal := &Identity{Name: "portal", Access: []Access{{Hosts: []string{"ltm1.example.org"}, Objects: []string{"*"}, Scope: scopeReadOnly}}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.router.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), portal)))
+	}))
+	defer srv.Close()
+
+	list := func(path string) []map[string]interface{} {
+		t.Helper()
+
+		resp := doRequest(t, http.MethodGet, srv.URL+path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d listing %s, got %d", http.StatusOK, path, resp.StatusCode)
+		}
+
+		out := struct {
+			Data []map[string]interface{} `json:"data"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		return out.Data
+	}
+
+	for _, path := range []string{"/v1/f5/jobs", "/v1/f5/audit"} {
+		if items := list(path); len(items) != 1 || items[0]["host"] != "ltm1.example.org" {
+			t.Errorf("expected only the ltm1 results from %s, got %+v", path, items)
+		}
+	}
+
+	if hosts := list("/v1/f5/hosts"); len(hosts) != 1 || hosts[0]["name"] != "ltm1.example.org" {
+		t.Errorf("expected only ltm1 from /v1/f5/hosts, got %+v", hosts)
+	}
+
+	for _, path := range []string{"/v1/f5/jobs/%s", "/v1/f5/jobs/%s/events"} {
+		if resp := doRequest(t, http.MethodGet, srv.URL+fmt.Sprintf(path, ids["ltm1.example.org"]), nil); resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %d for %s of an allowed job, got %d", http.StatusOK, path, resp.StatusCode)
+		}
+
+		if resp := doRequest(t, http.MethodGet, srv.URL+fmt.Sprintf(path, ids["ltm2.example.org"]), nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected %d for %s of a job on another host, got %d", http.StatusNotFound, path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "Idempotency-Key", "Prefer", "X-Auth-Token", requestIDHeader}
+	defaultCORSExposed = []string{"Idempotent-Replayed", "Location", "Retry-After", requestIDHeader}
+)
+
+// corsPolicy answers CORS preflight requests and sets the CORS headers on responses to allowed origins
+type corsPolicy struct {
+	origins     []string
+	methods     []string
+	headers     []string
+	exposed     []string
+	credentials bool
+	maxAge      int
+}
+
+// newCORSPolicy creates the CORS policy from the configuration.  Without any configuration all
+// origins are allowed, as they were before CORS was configurable.
+func newCORSPolicy(config common.CORSConfig) (*corsPolicy, error) {
+	c := &corsPolicy{
+		origins:     append([]string{}, config.AllowedOrigins...),
+		methods:     append([]string{}, config.AllowedMethods...),
+		headers:     append([]string{}, config.AllowedHeaders...),
+		exposed:     []string{requestIDHeader},
+		credentials: config.AllowCredentials,
+		maxAge:      600,
+	}
+
+	if len(c.origins) == 0 {
+		c.origins = []string{"*"}
+	}
+
+	for i, o := range c.origins {
+		c.origins[i] = strings.ToLower(o)
+		if o == "*" && c.credentials {
+			return nil, errors.New("cors allowCredentials cannot be used when all origins are allowed")
+		}
+	}
+
+	if len(c.methods) == 0 {
+		c.methods = append(c.methods, defaultCORSMethods...)
+	}
+
+	for i, m := range c.methods {
+		c.methods[i] = strings.ToUpper(m)
+	}
+
+	if len(c.headers) == 0 {
+		c.headers = append(c.headers, defaultCORSHeaders...)
+	}
+
+	if len(config.ExposedHeaders) == 0 {
+		c.exposed = append([]string{}, defaultCORSExposed...)
+	}
+
+	for _, h := range config.ExposedHeaders {
+		if !strings.EqualFold(h, requestIDHeader) {
+			c.exposed = append(c.exposed, h)
+		}
+	}
+
+	if config.MaxAge != "" {
+		maxAge, err := time.ParseDuration(config.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cors max age %q: %s", config.MaxAge, err)
+		}
+		c.maxAge = int(maxAge.Seconds())
+	}
+
+	return c, nil
+}
+
+// Middleware answers preflight requests before they're authenticated and sets the CORS headers on
+// the responses to other requests from allowed origins
+func (c *corsPolicy) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		allowed := c.allowOrigin(origin)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			c.preflight(w, r, origin, allowed)
+			return
+		}
+
+		if allowed {
+			c.setOrigin(w, origin)
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.exposed, ", "))
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// preflight responds to a CORS preflight request
+func (c *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string, allowed bool) {
+	w.Header().Add("Vary", "Access-Control-Request-Method")
+	w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	headers := requestedHeaders(r)
+
+	if !allowed || !c.allowMethod(method) || !c.allowHeaders(headers) {
+		log.Warnf("Rejecting CORS preflight from %s for %s %s", origin, method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	log.Debugf("Allowing CORS preflight from %s for %s %s", origin, method, r.URL.Path)
+
+	c.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if len(headers) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.maxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", fmt.Sprintf("%d", c.maxAge))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin sets the allowed origin and credentials headers.  The origin is only echoed when it
+// has to be, when credentials are allowed or only some origins are allowed.
+func (c *corsPolicy) setOrigin(w http.ResponseWriter, origin string) {
+	if len(c.origins) == 1 && c.origins[0] == "*" {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowOrigin returns true if the origin matches one of the allowed origins
+func (c *corsPolicy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, o := range c.origins {
+		if matchWildcard(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethod returns true if the method is allowed
+func (c *corsPolicy) allowMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders returns true if all of the headers are allowed
+func (c *corsPolicy) allowHeaders(headers []string) bool {
+	for _, h := range headers {
+		allowed := false
+		for _, a := range c.headers {
+			if a == "*" || strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// requestedHeaders returns the list of headers from the Access-Control-Request-Headers header
+func requestedHeaders(r *http.Request) []string {
+	headers := []string{}
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				headers = append(headers, h)
+			}
+		}
+	}
+	return headers
+}
+
+// matchWildcard matches the value against a pattern where '*' matches any characters, ie.
+// 'https://*.example.org'
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+
+	last := parts[len(parts)-1]
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleSpinup/f5-api/common"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		match          bool
+	}{
+		{"*", "https://portal.example.org", true},
+		{"https://portal.example.org", "https://portal.example.org", true},
+		{"https://portal.example.org", "https://portal.example.org.evil.com", false},
+		{"https://*.example.org", "https://portal.example.org", true},
+		{"https://*.example.org", "https://a.b.example.org", true},
+		{"https://*.example.org", "https://example.org", false},
+		{"https://*.example.org", "http://portal.example.org", false},
+		{"https://*.example.org", "https://portal.example.org.evil.com", false},
+		{"https://*.example.org:*", "https://portal.example.org:8443", true},
+	}
+
+	for _, test := range tests {
+		if got := matchWildcard(test.pattern, test.value); got != test.match {
+			t.Errorf("expected match %s against %s to be %t, got %t", test.value, test.pattern, test.match, got)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	cors, err := newCORSPolicy(common.CORSConfig{
+		AllowedOrigins:   []string{"https://*.example.org"},
+		AllowedMethods:   []string{"get", "put"},
+		ExposedHeaders:   []string{"Location"},
+		AllowCredentials: true,
+		MaxAge:           "1m",
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	var called bool
+	h := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		called = false
+		req := httptest.NewRequest(method, "/v1/f5/ltm.example.org/clientssl", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// allowed preflight
+	rr := request(http.MethodOptions, "https://portal.example.org", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "x-auth-token, content-type",
+	})
+	if rr.Code != http.StatusNoContent || called {
+		t.Errorf("expected %d for preflight without calling the handler, got %d, %t", http.StatusNoContent, rr.Code, called)
+	}
+
+	expected := map[string]string{
+		"Access-Control-Allow-Origin":      "https://portal.example.org",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "x-auth-token, content-type",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "60",
+	}
+	for k, v := range expected {
+		if h := rr.Header().Get(k); h != v {
+			t.Errorf("expected preflight header %s to be %q, got %q", k, v, h)
+		}
+	}
+
+	// disallowed preflights
+	rejected := []struct {
+		origin  string
+		headers map[string]string
+	}{
+		{"https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"}},
+		{"https://portal.example.org", map[string]string{"Access-Control-Request-Method": "DELETE"}},
+		{"https://portal.example.org", map[string]string{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Custom"}},
+	}
+	for _, r := range rejected {
+		if rr := request(http.MethodOptions, r.origin, r.headers); rr.Code != http.StatusForbidden || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("expected %d for preflight from %s with %v, got %d", http.StatusForbidden, r.origin, r.headers, rr.Code)
+		}
+	}
+
+	// actual requests
+	rr = request(http.MethodGet, "https://portal.example.org", nil)
+	if !called || rr.Header().Get("Access-Control-Allow-Origin") != "https://portal.example.org" {
+		t.Errorf("expected allowed origin header on request, got %v", rr.Header())
+	}
+
+	if h := rr.Header().Get("Access-Control-Expose-Headers"); h != "X-Request-Id, Location" {
+		t.Errorf("expected exposed headers 'X-Request-Id, Location', got %q", h)
+	}
+
+	rr = request(http.MethodGet, "https://evil.com", nil)
+	if !called || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers for a disallowed origin, got %v", rr.Header())
+	}
+
+	rr = request(http.MethodGet, "", nil)
+	if !called || rr.Header().Get("Vary") != "" {
+		t.Errorf("expected no CORS headers without an origin, got %v", rr.Header())
+	}
+}
+
+func TestNewCORSPolicy(t *testing.T) {
+	cors, err := newCORSPolicy(common.CORSConfig{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(cors.origins) != 1 || cors.origins[0] != "*" || cors.maxAge != 600 {
+		t.Errorf("expected all origins allowed by default, got %+v", cors)
+	}
+
+	bad := []common.CORSConfig{
+		{AllowCredentials: true},
+		{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		{MaxAge: "forever"},
+	}
+
+	for _, c := range bad {
+		if _, err := newCORSPolicy(c); err == nil {
+			t.Errorf("expected error for config %+v", c)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// dryRunRequested returns true if the client asked for the planned operations with the
+// dryRun query parameter instead of applying the changes
+func dryRunRequested(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// writeDryRun responds with the ordered list of operations planned for the request
+func writeDryRun(w http.ResponseWriter, operation, host, object string, plan []PlannedOperation) {
+	if plan == nil {
+		plan = []PlannedOperation{}
+	}
+
+	resp := newResponse(operation, host, object, plan)
+	resp.DryRun = true
+	writeResponse(w, http.StatusOK, resp)
+}
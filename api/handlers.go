@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/YaleSpinup/apierror"
 	"github.com/pkg/errors"
@@ -14,7 +15,6 @@ import (
 func (s *server) PingHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
 	log.Debug("Ping/Pong")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("pong"))
 }
@@ -22,17 +22,27 @@ func (s *server) PingHandler(w http.ResponseWriter, r *http.Request) {
 // VersionHandler responds to version requests
 func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 	w = LogWriter{w}
-	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Content-Type", "application/json")
 
+	revision, loadedAt := s.configVersion()
+
+	var configLoadedAt *time.Time
+	if !loadedAt.IsZero() {
+		configLoadedAt = &loadedAt
+	}
+
 	data, err := json.Marshal(struct {
-		Version    string `json:"version"`
-		GitHash    string `json:"githash"`
-		BuildStamp string `json:"buildstamp"`
+		Version        string     `json:"version"`
+		GitHash        string     `json:"githash"`
+		BuildStamp     string     `json:"buildstamp"`
+		ConfigVersion  string     `json:"configVersion,omitempty"`
+		ConfigLoadedAt *time.Time `json:"configLoadedAt,omitempty"`
 	}{
-		Version:    fmt.Sprintf("%s", s.version.Version),
-		GitHash:    s.version.GitHash,
-		BuildStamp: s.version.BuildStamp,
+		Version:        fmt.Sprintf("%s", s.version.Version),
+		GitHash:        s.version.GitHash,
+		BuildStamp:     s.version.BuildStamp,
+		ConfigVersion:  revision,
+		ConfigLoadedAt: configLoadedAt,
 	})
 
 	if err != nil {
@@ -49,23 +59,31 @@ func (s *server) VersionHandler(w http.ResponseWriter, r *http.Request) {
 func handleError(w http.ResponseWriter, err error) {
 	log.Error(err.Error())
 	if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+		var status int
 		switch aerr.Code {
 		case apierror.ErrForbidden:
-			w.WriteHeader(http.StatusForbidden)
+			status = http.StatusForbidden
 		case apierror.ErrNotFound:
-			w.WriteHeader(http.StatusNotFound)
+			status = http.StatusNotFound
 		case apierror.ErrConflict:
-			w.WriteHeader(http.StatusConflict)
+			status = http.StatusConflict
 		case apierror.ErrBadRequest:
-			w.WriteHeader(http.StatusBadRequest)
+			status = http.StatusBadRequest
 		case apierror.ErrLimitExceeded:
-			w.WriteHeader(http.StatusTooManyRequests)
+			status = http.StatusTooManyRequests
+		case apierror.ErrServiceUnavailable:
+			status = http.StatusServiceUnavailable
 		default:
-			w.WriteHeader(http.StatusInternalServerError)
+			status = http.StatusInternalServerError
 		}
-		w.Write([]byte(aerr.Message))
+
+		var cause error
+		if aerr.OrigErr != nil && aerr.OrigErr.Error() != "" {
+			cause = aerr.OrigErr
+		}
+
+		writeError(w, status, aerr.Code, aerr.Message, cause)
 	} else {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, http.StatusInternalServerError, apierror.ErrInternalError, err.Error(), nil)
 	}
 }
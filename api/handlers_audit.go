@@ -0,0 +1,83 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/audit"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListAuditEvents lists the audit events for changes made to the LTMs.  Events can be filtered by identity,
+// host, object, operation and outcome, and by time with the since and until RFC3339 timestamps.
+func (s *server) ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if s.audit == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "audit log is not enabled", nil))
+		return
+	}
+
+	q, err := parseListQuery(r, []string{"-time", "host", "identity", "operation"}, "identity", "host", "object", "operation", "outcome", "since", "until")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	filter := audit.Filter{
+		Identity:  q.filters["identity"],
+		Host:      q.filters["host"],
+		Object:    q.filters["object"],
+		Operation: q.filters["operation"],
+		Outcome:   audit.Outcome(q.filters["outcome"]),
+	}
+
+	if filter.Since, err = parseTimeFilter(q, "since"); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if filter.Until, err = parseTimeFilter(q, "until"); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	log.Debugf("listing audit events %+v", filter)
+
+	events := []audit.Event{}
+	for _, e := range s.audit.Query(filter) {
+		if allowsHost(r, e.Host) && q.matchName(e.Object) {
+			events = append(events, e)
+		}
+	}
+
+	sortItems(q, events, map[string]func(a, b audit.Event) bool{
+		"time":      func(a, b audit.Event) bool { return a.Time.Before(b.Time) },
+		"host":      func(a, b audit.Event) bool { return a.Host < b.Host },
+		"identity":  func(a, b audit.Event) bool { return a.Identity < b.Identity },
+		"operation": func(a, b audit.Event) bool { return a.Operation < b.Operation },
+	})
+
+	page, p := paginate(q, events)
+	resp := newResponse("listaudit", "", "", page)
+	resp.Pagination = p
+
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// parseTimeFilter parses an optional RFC3339 timestamp filter from the list query
+func parseTimeFilter(q *listQuery, name string) (time.Time, error) {
+	v, ok := q.filters[name]
+	if !ok {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, apierror.New(apierror.ErrBadRequest, fmt.Sprintf("invalid %s time, expected RFC3339", name), err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/audit"
+	"github.com/YaleSpinup/f5-api/ltm"
+	"github.com/gorilla/mux"
+)
+
+func TestAuditEvents(t *testing.T) {
+	auditLog, err := audit.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := newMockLTM(t)
+	s := server{
+		router:      mux.NewRouter(),
+		context:     context.TODO(),
+		LTMServices: map[string]ltm.LTMIface{"ltm.example.org": client},
+		audit:       auditLog,
+	}
+	s.routes()
+
+	srv := httptest.NewServer(RequestIDMiddleware(s.router))
+	defer srv.Close()
+
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/v2/f5/ltm.example.org/clientssl", testProfileRequest(t, "new.example.org")); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected %d creating profile, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// a failed create is rolled back
+	client.failOn = "CreateClientSSLProfile"
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/v2/f5/ltm.example.org/clientssl", testProfileRequest(t, "broken.example.org")); resp.StatusCode == http.StatusCreated {
+		t.Fatal("expected error creating profile")
+	}
+
+	// dry-runs don't change anything
+	if resp := doRequest(t, http.MethodPost, srv.URL+"/v2/f5/ltm.example.org/clientssl?dryRun=true", testProfileRequest(t, "planned.example.org")); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d for dry-run, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	list := func(query string) []audit.Event {
+		t.Helper()
+
+		resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/audit"+query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d listing audit events with %q, got %d", http.StatusOK, query, resp.StatusCode)
+		}
+
+		out := struct {
+			Data []audit.Event
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		return out.Data
+	}
+
+	events := list("?object=new.example.org&sort=time")
+	if len(events) != 5 {
+		t.Fatalf("expected 5 events for new.example.org, got %+v", events)
+	}
+
+	for _, e := range events {
+		if e.Outcome != audit.OutcomeSucceeded || e.Host != "ltm.example.org" || e.Operation != "createclientssl" || e.Identity != "anonymous" || e.RequestID == "" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+
+	if last := events[4]; last.Action != "CreateClientSSLProfile" || len(last.After) == 0 {
+		t.Errorf("expected the create profile event with after state, got %+v", last)
+	}
+
+	failed := list("?outcome=failed")
+	if len(failed) != 1 || failed[0].Object != "broken.example.org" || failed[0].Error == "" {
+		t.Errorf("expected the failed create profile event, got %+v", failed)
+	}
+
+	rollbacks := list("?object=broken.example.org&match=broken&sort=-time&limit=2")
+	if len(rollbacks) != 2 || rollbacks[0].Step != "rollback import certificate" || rollbacks[1].Step != "rollback import key" {
+		t.Errorf("expected the rollback events, got %+v", rollbacks)
+	}
+
+	if events := list("?object=planned.example.org"); len(events) != 0 {
+		t.Errorf("expected no events for a dry-run, got %+v", events)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if events := list("?since=" + future); len(events) != 0 {
+		t.Errorf("expected no events since %s, got %d", future, len(events))
+	}
+
+	if resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/audit?since=yesterday", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d for an invalid since time, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
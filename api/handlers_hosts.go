@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListHosts lists the configured LTM hosts with their reachability, version and failover state
+func (s *server) ListHosts(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	log.Info("listing ltm hosts")
+
+	if s.hosts == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "host monitoring is not enabled", nil))
+		return
+	}
+
+	all, _ := s.hostStatus(r.Context())
+
+	hosts := make([]*HostStatus, 0, len(all))
+	for _, h := range all {
+		if allowsHost(r, h.Name) {
+			hosts = append(hosts, h)
+		}
+	}
+
+	writeResponse(w, http.StatusOK, newResponse("listhosts", "", "", hosts))
+}
+
+// ReadyHandler probes the LTM hosts and responds with 503 Service Unavailable if the service
+// isn't ready according to the health policy
+func (s *server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	out, err := s.readiness(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !out.Ready {
+		log.Warnf("service is not ready: %s", out.Reason)
+		status = http.StatusServiceUnavailable
+	}
+
+	writeResponse(w, status, newResponse("ready", "", "", out))
+}
+
+// HealthHandler probes the LTM hosts and responds with whether each host is up and the readiness
+// of the service.  Unlike the ready endpoint, it always responds with 200 OK.
+func (s *server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	out, err := s.readiness(r)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	writeResponse(w, http.StatusOK, newResponse("health", "", "", out))
+}
+
+func (s *server) readiness(r *http.Request) (*Readiness, error) {
+	if s.hosts == nil || s.readyPolicy == nil {
+		return nil, apierror.New(apierror.ErrServiceUnavailable, "host monitoring is not enabled", nil)
+	}
+
+	hosts, checkedAt := s.hosts.status(r.Context(), s.ltmServices())
+	return s.readyPolicy.evaluate(hosts, checkedAt), nil
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/job"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListJobs lists the asynchronous jobs
+func (s *server) ListJobs(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+
+	if s.jobs == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "jobs are not enabled", nil))
+		return
+	}
+
+	q, err := parseListQuery(r, []string{"-createdAt", "host", "operation", "status"}, "host", "operation", "status")
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	jobs := []*job.Job{}
+	for _, j := range s.jobs.List() {
+		if !allowsHost(r, j.Host) || !q.matchName(j.Object) {
+			continue
+		}
+
+		if v, ok := q.filters["host"]; ok && j.Host != v {
+			continue
+		}
+
+		if v, ok := q.filters["operation"]; ok && j.Operation != v {
+			continue
+		}
+
+		if v, ok := q.filters["status"]; ok && string(j.Status) != v {
+			continue
+		}
+
+		jobs = append(jobs, j)
+	}
+
+	sortItems(q, jobs, map[string]func(a, b *job.Job) bool{
+		"createdAt": func(a, b *job.Job) bool { return a.CreatedAt.Before(b.CreatedAt) },
+		"host":      func(a, b *job.Job) bool { return a.Host < b.Host },
+		"operation": func(a, b *job.Job) bool { return a.Operation < b.Operation },
+		"status":    func(a, b *job.Job) bool { return a.Status < b.Status },
+	})
+
+	page, p := paginate(q, jobs)
+	resp := newResponse("listjobs", "", "", page)
+	resp.Pagination = p
+
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// ShowJob shows the status, step progress, output and errors of an asynchronous job
+func (s *server) ShowJob(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	log.Debugf("getting job %s", id)
+
+	if s.jobs == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "jobs are not enabled", nil))
+		return
+	}
+
+	out, err := s.jobs.Get(id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if !allowsHost(r, out.Host) {
+		handleError(w, jobNotFound(id))
+		return
+	}
+
+	writeResponse(w, http.StatusOK, newResponse("showjob", out.Host, id, out))
+}
+
+// JobEvents streams the progress of an asynchronous job as server-sent events.  The current
+// state of the job is sent first as a 'snapshot' event, followed by a 'step' event each time a
+// step starts or finishes and a 'job' event each time the job status changes.  The stream ends
+// when the job finishes, or with a 'reset' event if the client falls too far behind, in which
+// case the client should reconnect for a new snapshot.
+func (s *server) JobEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	log.Debugf("streaming events for job %s", id)
+
+	if s.jobs == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "jobs are not enabled", nil))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleError(w, apierror.New(apierror.ErrInternalError, "streaming is not supported", nil))
+		return
+	}
+
+	snapshot, events, cancel, err := s.jobs.Subscribe(id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	defer cancel()
+
+	if !allowsHost(r, snapshot.Host) {
+		handleError(w, jobNotFound(id))
+		return
+	}
+
+	// the event stream outlives the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Warnf("unable to clear write deadline for job %s event stream: %s", id, err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeEvent(w, "snapshot", snapshot); err != nil {
+		log.Warnf("failed to write job %s snapshot: %s", id, err)
+		return
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debugf("client disconnected from job %s event stream", id)
+			return
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				log.Debugf("job %s event stream finished", id)
+				return
+			}
+
+			if err := writeEvent(w, string(e.Type), e); err != nil {
+				log.Warnf("failed to write job %s event: %s", id, err)
+				return
+			}
+			flusher.Flush()
+
+			if e.Type == job.EventTypeReset {
+				log.Warnf("job %s event stream fell behind, the client must reconnect", id)
+				return
+			}
+		}
+	}
+}
+
+// jobNotFound is the error for a job that doesn't exist or that's for a host the caller can't
+// access, so the caller can't tell them apart
+func jobNotFound(id string) error {
+	return apierror.New(apierror.ErrNotFound, fmt.Sprintf("job %s not found", id), nil)
+}
+
+// writeEvent writes a single server-sent event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, j)
+	return err
+}
+
+// asyncRequested returns true if the client asked for the request to be processed as a
+// background job, either with the async query parameter or with a 'Prefer: respond-async' header
+func asyncRequested(r *http.Request) bool {
+	if v := r.URL.Query().Get("async"); v != "" {
+		async, _ := strconv.ParseBool(v)
+		return async
+	}
+
+	return strings.Contains(r.Header.Get("Prefer"), "respond-async")
+}
+
+// startJob starts f as a background job and responds with 202 Accepted and the new job
+func (s *server) startJob(w http.ResponseWriter, operation, host, object string, f job.Func) {
+	if s.jobs == nil {
+		handleError(w, apierror.New(apierror.ErrServiceUnavailable, "jobs are not enabled", nil))
+		return
+	}
+
+	out, err := s.jobs.Start(s.context, operation, host, object, f)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/f5/jobs/%s", out.ID))
+	writeResponse(w, http.StatusAccepted, newResponse(operation, host, object, out))
+}
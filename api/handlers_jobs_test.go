@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/YaleSpinup/f5-api/job"
+	"github.com/gorilla/mux"
+)
+
+func TestJobEvents(t *testing.T) {
+	jobs, err := job.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server{
+		router:  mux.NewRouter(),
+		context: context.TODO(),
+		jobs:    jobs,
+	}
+	s.routes()
+
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+
+	start := make(chan struct{})
+	j, err := jobs.Start(context.TODO(), "createclientssl", "host", "object", func(ctx context.Context, tr *job.Tracker) (interface{}, error) {
+		<-start
+		return "done", tr.Step("upload certificate", func() error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(srv.URL + "/v1/f5/jobs/" + j.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected content type text/event-stream, got %s", ct)
+	}
+
+	close(start)
+
+	events := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+
+	// the job may already be running when the snapshot is taken
+	got := strings.Join(events, ",")
+	if got != "snapshot,job,step,step,job" && got != "snapshot,step,step,job" {
+		t.Errorf("unexpected events %v", events)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/f5/jobs/missing/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status %d for missing job, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"path"
+	"time"
 
 	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/audit"
+	"github.com/YaleSpinup/f5-api/job"
+	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 )
@@ -19,28 +26,138 @@ func (s *server) ListClientSSLProfiles(w http.ResponseWriter, r *http.Request) {
 
 	log.Infof("list client ssl profiles %s", host)
 
-	ltmService, ok := s.LTMServices[host]
+	ltmService, ok := s.ltmService(host)
 	if !ok {
 		msg := fmt.Sprintf("LTM host service not found for account: %s", host)
 		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
 		return
 	}
 
-	out, err := ltmService.ListClientSSLProfiles()
+	q, err := parseListQuery(r, []string{"name", "certExpiration"}, "cert", "defaultsFrom", "partition")
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	j, err := json.Marshal(out)
+	// the names are enough unless the profile settings are needed to filter, sort or expand
+	if !q.expand && len(q.filters) == 0 && q.sortKey == "name" {
+		names, err := ltmService.ListClientSSLProfiles()
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+
+		out := []string{}
+		for _, n := range names {
+			if q.matchName(n) {
+				out = append(out, n)
+			}
+		}
+
+		sortItems(q, out, map[string]func(a, b string) bool{
+			"name": func(a, b string) bool { return a < b },
+		})
+
+		page, p := paginate(q, out)
+		resp := newResponse("listclientssl", host, "", page)
+		resp.Pagination = p
+		writeResponse(w, http.StatusOK, resp)
+		return
+	}
+
+	out, err := clientSSLProfileDetails(ltmService, q)
 	if err != nil {
-		handleError(w, apierror.New(apierror.ErrBadRequest, "failed to marshal json", err))
+		handleError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(j)
+	sortItems(q, out, map[string]func(a, b *ClientSSLProfileDetail) bool{
+		"name": func(a, b *ClientSSLProfileDetail) bool { return a.Name < b.Name },
+		"certExpiration": func(a, b *ClientSSLProfileDetail) bool {
+			// profiles without a known expiration sort last
+			if a.CertExpiration == nil || b.CertExpiration == nil {
+				return a.CertExpiration != nil && b.CertExpiration == nil
+			}
+			return a.CertExpiration.Before(*b.CertExpiration)
+		},
+	})
+
+	page, p := paginate(q, out)
+
+	var resp *Response
+	if q.expand {
+		resp = newResponse("listclientssl", host, "", page)
+	} else {
+		names := make([]string, 0, len(page))
+		for _, d := range page {
+			names = append(names, d.Name)
+		}
+		resp = newResponse("listclientssl", host, "", names)
+	}
+	resp.Pagination = p
+
+	writeResponse(w, http.StatusOK, resp)
+}
+
+// clientSSLProfileDetails lists the client ssl profiles matching the query, with the details
+// of their certificates
+func clientSSLProfileDetails(ltmService ltm.LTMIface, q *listQuery) ([]*ClientSSLProfileDetail, error) {
+	profiles, err := ltmService.ListClientSSLProfileDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	certs := map[string]bigip.Certificate{}
+	if q.expand || q.sortKey == "certExpiration" {
+		list, err := ltmService.ListCertificates()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range list {
+			certs[c.FullPath] = c
+			certs[c.Name] = c
+		}
+	}
+
+	out := []*ClientSSLProfileDetail{}
+	for _, p := range profiles {
+		if !q.matchName(p.Name) {
+			continue
+		}
+
+		if v, ok := q.filters["cert"]; ok && !matchPath(p.Cert, v) {
+			continue
+		}
+
+		if v, ok := q.filters["defaultsFrom"]; ok && !matchPath(p.DefaultsFrom, v) {
+			continue
+		}
+
+		if v, ok := q.filters["partition"]; ok && p.Partition != v {
+			continue
+		}
+
+		d := &ClientSSLProfileDetail{ClientSSLProfile: p}
+		if c, ok := certs[p.Cert]; ok {
+			d.CertSubject = c.Subject
+			d.CertIssuer = c.Issuer
+			if c.ExpirationDate > 0 {
+				exp := time.Unix(c.ExpirationDate, 0).UTC()
+				d.CertExpiration = &exp
+			}
+		}
+
+		out = append(out, d)
+	}
+
+	return out, nil
+}
+
+// matchPath returns true if the ltm object path matches the value, either by
+// full path (ie. /Common/example.crt) or by name (ie. example.crt)
+func matchPath(p, value string) bool {
+	return p == value || path.Base(p) == value
 }
 
 // ShowClientSSLProfile Show detail of Client SSL Profile on LTM
@@ -52,7 +169,7 @@ func (s *server) ShowClientSSLProfile(w http.ResponseWriter, r *http.Request) {
 
 	log.Infof("getting details about client ssl profile %s", name)
 
-	ltmService, ok := s.LTMServices[host]
+	ltmService, ok := s.ltmService(host)
 	if !ok {
 		msg := fmt.Sprintf("LTM host service not found for account: %s", host)
 		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
@@ -62,6 +179,7 @@ func (s *server) ShowClientSSLProfile(w http.ResponseWriter, r *http.Request) {
 	out, err := ltmService.GetClientSSLProfile(name)
 	if err != nil {
 		handleError(w, err)
+		return
 	}
 
 	if out == nil {
@@ -69,15 +187,7 @@ func (s *server) ShowClientSSLProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	j, err := json.Marshal(out)
-	if err != nil {
-		handleError(w, apierror.New(apierror.ErrBadRequest, "failed to marshal json", err))
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(j)
+	writeResponse(w, http.StatusOK, newResponse("showclientssl", host, name, out))
 }
 
 // ModifyClientSSLProfile updates a clientssl profile including updating the cert and key if supplied in the body
@@ -89,39 +199,19 @@ func (s *server) ModifyClientSSLProfile(w http.ResponseWriter, r *http.Request)
 
 	log.Infof("update client-ssl profile %s on host %s", name, host)
 
-	raw, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		handleError(w, err)
-		return
-	}
-	defer r.Body.Close()
-
 	data := ModifyClientSSLProfileRequest{}
-	if err := json.Unmarshal(raw, &data); err != nil {
-		handleError(w, err)
-	}
-
-	ltmService, ok := s.LTMServices[host]
-	if !ok {
-		msg := fmt.Sprintf("LTM host service not found for account: %s", host)
-		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
-		return
-	}
-
-	orch := &ltmOrchestrator{
-		client: ltmService,
-	}
-
-	if err := orch.modifyClientSSLProfile(r.Context(), &data); err != nil {
+	if err := decodeRequest(r, &data); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	out := []byte(fmt.Sprintf("modified client-ssl profile %s on host %s", name, host))
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(out)
+	s.orchestrate(w, r, "updateclientssl", host, name, http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.modifyClientSSLProfile(ctx, &data); err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("modified client-ssl profile %s on host %s", name, host), nil
+		})
 }
 
 // CreateClientSSLProfile creates SSL Client Profile
@@ -133,39 +223,19 @@ func (s *server) CreateClientSSLProfile(w http.ResponseWriter, r *http.Request)
 
 	log.Infof("create client-ssl profile %s on host %s", name, host)
 
-	raw, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		handleError(w, err)
-		return
-	}
-	defer r.Body.Close()
-
 	data := ModifyClientSSLProfileRequest{}
-	if err := json.Unmarshal(raw, &data); err != nil {
-		handleError(w, err)
-	}
-
-	ltmService, ok := s.LTMServices[host]
-	if !ok {
-		msg := fmt.Sprintf("LTM host service not found for account: %s", host)
-		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
-		return
-	}
-
-	orch := &ltmOrchestrator{
-		client: ltmService,
-	}
-
-	if err := orch.createClientSSLProfile(r.Context(), &data); err != nil {
+	if err := decodeRequest(r, &data); err != nil {
 		handleError(w, err)
 		return
 	}
 
-	out := []byte(fmt.Sprintf("created client-ssl profile %s on host %s", name, host))
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(out)
+	s.orchestrate(w, r, "createclientssl", host, name, http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.createClientSSLProfile(ctx, &data); err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("created client-ssl profile %s on host %s", name, host), nil
+		})
 }
 
 // DeleteClientSSLProfile deletes SSL Client Profile and cert-key pair
@@ -177,7 +247,22 @@ func (s *server) DeleteClientSSLProfile(w http.ResponseWriter, r *http.Request)
 
 	log.Infof("delete client-ssl profile %s on host %s", name, host)
 
-	ltmService, ok := s.LTMServices[host]
+	s.orchestrate(w, r, "deleteclientssl", host, name, http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.deleteClientSSLProfile(ctx, name); err != nil {
+				return nil, err
+			}
+			return fmt.Sprintf("deleted client-ssl profile %s on host %s", name, host), nil
+		})
+}
+
+// orchestrate runs f with an orchestrator for the LTM host and writes the output with the given
+// status.  Depending on the request, f is run in dry-run mode and the planned operations are
+// returned, or f is run in the background as a job and 202 Accepted is returned.  Requests that
+// aren't run as a job wait at most syncRequestTimeout for an automatic sync, and return 200 OK
+// instead of 204 No Content when there's a sync result.
+func (s *server) orchestrate(w http.ResponseWriter, r *http.Request, operation, host, object string, status int, f func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error)) {
+	ltmService, ok := s.ltmService(host)
 	if !ok {
 		msg := fmt.Sprintf("LTM host service not found for account: %s", host)
 		handleError(w, apierror.New(apierror.ErrNotFound, msg, nil))
@@ -186,16 +271,87 @@ func (s *server) DeleteClientSSLProfile(w http.ResponseWriter, r *http.Request)
 
 	orch := &ltmOrchestrator{
 		client: ltmService,
+		audit:  s.audit,
+		saver:  s.saver,
+		event: audit.Event{
+			RequestID: requestID(r.Context()),
+			Identity:  identityName(r.Context()),
+			Host:      host,
+			Object:    object,
+			Operation: operation,
+		},
+	}
+
+	if dryRunRequested(r) {
+		orch.dryRun = true
+		if _, err := f(r.Context(), orch); err != nil {
+			handleError(w, err)
+			return
+		}
+		orch.autoSync(r.Context())
+		orch.autoSave(r.Context())
+		writeDryRun(w, operation, host, object, orch.plan)
+		return
+	}
+
+	if asyncRequested(r) {
+		id := requestID(r.Context())
+		s.startJob(w, operation, host, object, func(ctx context.Context, t *job.Tracker) (interface{}, error) {
+			orch.tracker = t
+			out, err := f(ctx, orch)
+			if err != nil {
+				return nil, err
+			}
+
+			resp := newResponse(operation, host, object, out)
+			resp.RequestID = id
+			resp.Sync = orch.autoSync(ctx)
+			orch.autoSave(ctx)
+			return resp, nil
+		})
+		return
 	}
 
-	if err := orch.deleteClientSSLProfile(r.Context(), name); err != nil {
+	orch.syncTimeout = syncRequestTimeout
+	out, err := f(r.Context(), orch)
+	if err != nil {
 		handleError(w, err)
 		return
 	}
 
-	out := []byte(fmt.Sprintf("deleted client-ssl profile %s on host %s", name, host))
+	sync := orch.autoSync(r.Context())
+	orch.autoSave(r.Context())
+
+	// the sync result is returned in the response, so there's only no content without it
+	if status == http.StatusNoContent && sync == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	if status == http.StatusNoContent {
+		status = http.StatusOK
+	}
+
+	if orch.location != "" {
+		w.Header().Set("Location", orch.location)
+	}
+
+	resp := newResponse(operation, host, object, out)
+	resp.Sync = sync
+	writeResponse(w, status, resp)
+}
+
+// decodeRequest reads and decodes the JSON request body into data
+func decodeRequest(r *http.Request, data interface{}) error {
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to read request body", err)
+	}
+	defer r.Body.Close()
+
+	if err := json.Unmarshal(raw, data); err != nil {
+		return apierror.New(apierror.ErrBadRequest, "failed to unmarshal request", err)
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(out)
+	return nil
 }
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/YaleSpinup/apierror"
+	bigip "github.com/YaleUniversity/go-bigip"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateClientSSLProfileV2 creates a client-ssl profile named in the body, uploading and importing the cert and key
+func (s *server) CreateClientSSLProfileV2(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	host := vars["host"]
+
+	data := ModifyClientSSLProfileRequest{}
+	if err := decodeRequest(r, &data); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	name := data.ClientSSLProfileName
+	if name == "" {
+		handleError(w, apierror.New(apierror.ErrBadRequest, "clientssl-profile is required", nil))
+		return
+	}
+
+	log.Infof("create client-ssl profile %s on host %s", name, host)
+
+	s.orchestrate(w, r, "createclientssl", host, name, http.StatusCreated,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.createClientSSLProfile(ctx, &data); err != nil {
+				return nil, err
+			}
+
+			if orch.dryRun {
+				return nil, nil
+			}
+			orch.location = fmt.Sprintf("/v2/f5/%s/clientssl/%s", host, name)
+
+			return orch.readBack(name), nil
+		})
+}
+
+// ReplaceClientSSLProfile replaces the settings, cert and key of the client-ssl profile named in the path
+func (s *server) ReplaceClientSSLProfile(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	host := vars["host"]
+	name := vars["name"]
+
+	log.Infof("replace client-ssl profile %s on host %s", name, host)
+
+	data := ModifyClientSSLProfileRequest{}
+	if err := decodeRequest(r, &data); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := setProfileName(name, &data.ClientSSLProfileName); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	s.orchestrate(w, r, "replaceclientssl", host, name, http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.modifyClientSSLProfile(ctx, &data); err != nil {
+				return nil, err
+			}
+			return orch.readBack(name), nil
+		})
+}
+
+// PatchClientSSLProfile updates the fields supplied in the body of the client-ssl profile named in the path
+func (s *server) PatchClientSSLProfile(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	host := vars["host"]
+	name := vars["name"]
+
+	log.Infof("patch client-ssl profile %s on host %s", name, host)
+
+	data := PatchClientSSLProfileRequest{}
+	if err := decodeRequest(r, &data); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if err := setProfileName(name, &data.ClientSSLProfileName); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	s.orchestrate(w, r, "patchclientssl", host, name, http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			if err := orch.patchClientSSLProfile(ctx, &data); err != nil {
+				return nil, err
+			}
+			return orch.readBack(name), nil
+		})
+}
+
+// DeleteClientSSLProfileV2 deletes the client-ssl profile named in the path and its cert-key pair
+func (s *server) DeleteClientSSLProfileV2(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	vars := mux.Vars(r)
+	host := vars["host"]
+	name := vars["name"]
+
+	log.Infof("delete client-ssl profile %s on host %s", name, host)
+
+	s.orchestrate(w, r, "deleteclientssl", host, name, http.StatusNoContent,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			return nil, orch.deleteClientSSLProfile(ctx, name)
+		})
+}
+
+// readBack gets the client-ssl profile after it was changed, from the active unit of a host group
+// so the changes are included.  The changes were made, so failing to read the profile back doesn't
+// fail the request, only its name is returned.
+func (o *ltmOrchestrator) readBack(name string) *bigip.ClientSSLProfile {
+	profile, err := o.getClientSSLProfile(name)
+	if err != nil || profile == nil {
+		log.Warnf("changed client-ssl profile %s on host %s, but failed to get it: %v", name, o.event.Host, err)
+		return &bigip.ClientSSLProfile{Name: name}
+	}
+	return profile
+}
+
+// setProfileName sets the profile name in the request body to the name from the path, the path
+// is authoritative so a different name in the body is rejected
+func setProfileName(name string, bodyName *string) error {
+	if *bodyName != "" && *bodyName != name {
+		msg := fmt.Sprintf("clientssl-profile %s in the body doesn't match %s in the path", *bodyName, name)
+		return apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	*bodyName = name
+	return nil
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
+	"github.com/gorilla/mux"
+)
+
+func newTestServer(t *testing.T, client ltm.LTMIface) *httptest.Server {
+	s := server{
+		router:      mux.NewRouter(),
+		context:     context.TODO(),
+		LTMServices: map[string]ltm.LTMIface{"ltm.example.org": client},
+		hosts:       newHostMonitor(map[string]string{"ltm.example.org": "ltm.example.org"}),
+		readyPolicy: &readinessPolicy{mode: readyPolicyAny},
+	}
+	s.routes()
+
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func doRequest(t *testing.T, method, url string, body interface{}) *http.Response {
+	t.Helper()
+
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+func TestClientSSLProfileV2(t *testing.T) {
+	existing := &bigip.ClientSSLProfile{
+		Name:         "existing.example.org",
+		Cert:         "/Common/existing.example.org-2020.crt",
+		Key:          "/Common/existing.example.org-2020.key",
+		Chain:        "/Common/intermediate-chain.crt",
+		DefaultsFrom: "/Common/clientssl",
+		CipherGroup:  "/Common/default-tlsv1.2",
+		Ciphers:      "none",
+	}
+
+	client := newMockLTM(t, existing)
+	srv := newTestServer(t, client)
+	base := srv.URL + "/v2/f5/ltm.example.org/clientssl"
+
+	// create requires a name in the body
+	data := testProfileRequest(t, "")
+	if resp := doRequest(t, http.MethodPost, base, data); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d creating profile without a name, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	data = testProfileRequest(t, "new.example.org")
+	resp := doRequest(t, http.MethodPost, base, data)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected %d creating profile, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	if l := resp.Header.Get("Location"); l != "/v2/f5/ltm.example.org/clientssl/new.example.org" {
+		t.Errorf("unexpected location header %s", l)
+	}
+
+	out := Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Operation != "createclientssl" || out.Host != "ltm.example.org" || out.Object != "new.example.org" {
+		t.Errorf("unexpected response envelope %+v", out)
+	}
+
+	// failed creates don't have a location
+	data = testProfileRequest(t, "existing.example.org")
+	resp = doRequest(t, http.MethodPost, base, data)
+	if resp.StatusCode != http.StatusConflict || resp.Header.Get("Location") != "" {
+		t.Errorf("expected %d without a location creating an existing profile, got %d %q", http.StatusConflict, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	data = testProfileRequest(t, "planned.example.org")
+	resp = doRequest(t, http.MethodPost, base+"?dryRun=true", data)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Location") != "" {
+		t.Errorf("expected %d without a location for a dry-run create, got %d %q", http.StatusOK, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// the profile was created even if it can't be read back
+	created := newMockLTM(t)
+	created.getFailsAfter = "CreateClientSSLProfile"
+	resp = doRequest(t, http.MethodPost, newTestServer(t, created).URL+"/v2/f5/ltm.example.org/clientssl", testProfileRequest(t, "new.example.org"))
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/v2/f5/ltm.example.org/clientssl/new.example.org" {
+		t.Errorf("expected %d with a location when the created profile can't be read, got %d %q", http.StatusCreated, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	profile := struct {
+		Data bigip.ClientSSLProfile
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Data.Name != "new.example.org" {
+		t.Errorf("expected the name of the created profile, got %+v", profile.Data)
+	}
+
+	// replaced and patched profiles that can't be read back are returned by name
+	for method, write := range map[string]string{http.MethodPut: "ModifyClientSSLProfile", http.MethodPatch: "PatchClientSSLProfile"} {
+		changed := newMockLTM(t, &bigip.ClientSSLProfile{Name: "existing.example.org", Cert: "existing.example.org-2020.crt", Key: "existing.example.org-2020.key"})
+		changed.getFailsAfter = write
+
+		var body interface{} = testProfileRequest(t, "")
+		if method == http.MethodPatch {
+			body = map[string]interface{}{"ciphergroup": "/Common/f5-secure"}
+		}
+
+		resp := doRequest(t, method, newTestServer(t, changed).URL+"/v2/f5/ltm.example.org/clientssl/existing.example.org", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected %d when the %s profile can't be read, got %d", http.StatusOK, method, resp.StatusCode)
+			continue
+		}
+
+		profile := struct {
+			Data bigip.ClientSSLProfile
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+			t.Fatal(err)
+		}
+
+		if profile.Data.Name != "existing.example.org" {
+			t.Errorf("expected the name of the %s profile, got %+v", method, profile.Data)
+		}
+	}
+
+	// the path name is authoritative
+	data = testProfileRequest(t, "other.example.org")
+	if resp := doRequest(t, http.MethodPut, base+"/existing.example.org", data); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d replacing profile with a mismatched name, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+
+	data = testProfileRequest(t, "")
+	if resp := doRequest(t, http.MethodPut, base+"/existing.example.org", data); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d replacing profile, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// patch with only a cert and key
+	cert, key := testCertificateAndKey(t)
+	patch := map[string]string{"cert": cert, "key": key}
+	if resp := doRequest(t, http.MethodPatch, base+"/existing.example.org", patch); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d patching profile, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// patch without a cert and key only changes the supplied fields
+	client.writes = nil
+	if resp := doRequest(t, http.MethodPatch, base+"/existing.example.org", map[string]interface{}{
+		"ciphergroup":   "/Common/f5-secure",
+		"renegotiation": false,
+		"tlsversions":   []string{"TLSv1.2", "TLSv1.3"},
+	}); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d patching profile, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if len(client.writes) != 1 || client.writes[0] != "PatchClientSSLProfile existing.example.org" {
+		t.Errorf("expected only the profile to be patched, got %v", client.writes)
+	}
+
+	invalid := []map[string]interface{}{
+		{},
+		{"cert": cert},
+		{"tlsversions": []string{"SSLv3"}},
+	}
+	for _, p := range invalid {
+		if resp := doRequest(t, http.MethodPatch, base+"/existing.example.org", p); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected %d patching profile with %v, got %d", http.StatusBadRequest, p, resp.StatusCode)
+		}
+	}
+
+	if resp := doRequest(t, http.MethodPatch, base+"/missing.example.org", patch); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected %d patching missing profile, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	if resp := doRequest(t, http.MethodDelete, base+"/existing.example.org", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected %d deleting profile, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	if resp := doRequest(t, http.MethodDelete, srv.URL+"/v2/f5/missing.example.org/clientssl/existing.example.org", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected %d for missing host, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+
+	// v1 keeps working alongside v2
+	data = testProfileRequest(t, "existing.example.org")
+	if resp := doRequest(t, http.MethodPut, srv.URL+"/v1/f5/ltm.example.org/updateclientssl/existing.example.org", data); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d updating profile with v1, got %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestReplaceClientSSLProfileGroup(t *testing.T) {
+	// the standby unit has the profile from before the last change on the active unit
+	standby := newMockLTM(t, &bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2020.crt", Key: "www.example.org-2020.key"})
+	standby.failover = "STANDBY"
+	active := newMockLTM(t, &bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2021.crt", Key: "www.example.org-2021.key"})
+
+	group := ltm.NewGroup("pair", "sync-failover", []ltm.GroupMember{
+		{Name: "ltm1", Service: standby},
+		{Name: "ltm2", Service: active},
+	})
+	srv := newTestServer(t, group)
+
+	resp := doRequest(t, http.MethodPut, srv.URL+"/v2/f5/ltm.example.org/clientssl/www.example.org", testProfileRequest(t, ""))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	profile := struct {
+		Data bigip.ClientSSLProfile
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Data.Cert != "www.example.org-2021.crt" {
+		t.Errorf("expected the profile from the active unit, got %+v", profile.Data)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+)
+
+const (
+	// readyPolicyAll requires every configured ltm host to be reachable
+	readyPolicyAll = "all"
+	// readyPolicyAny requires at least one configured ltm host to be reachable
+	readyPolicyAny = "any"
+)
+
+// Readiness is the result of probing the configured ltm hosts.  It's returned without
+// authentication, so it only has whether each host is up, the details are in HostStatus.
+type Readiness struct {
+	Ready     bool         `json:"ready"`
+	Policy    string       `json:"policy"`
+	Reason    string       `json:"reason,omitempty"`
+	CheckedAt time.Time    `json:"checkedAt"`
+	Hosts     []HostHealth `json:"hosts"`
+}
+
+// HostHealth is whether a configured ltm host is up
+type HostHealth struct {
+	Name      string `json:"name"`
+	Reachable bool   `json:"reachable"`
+}
+
+// readinessPolicy decides whether the service is ready from the status of the ltm hosts
+type readinessPolicy struct {
+	mode     string
+	required []string
+}
+
+// newReadinessPolicy creates the readiness policy from the health configuration, the default
+// policy is ready when any host is reachable
+func newReadinessPolicy(config common.HealthConfig) (*readinessPolicy, error) {
+	p := &readinessPolicy{
+		mode:     readyPolicyAny,
+		required: config.Required,
+	}
+
+	switch config.Policy {
+	case "":
+	case readyPolicyAll, readyPolicyAny:
+		p.mode = config.Policy
+	default:
+		return nil, fmt.Errorf("invalid health policy %q, must be one of '%s' or '%s'", config.Policy, readyPolicyAll, readyPolicyAny)
+	}
+
+	return p, nil
+}
+
+// evaluate returns the readiness of the service for the given host status
+func (p *readinessPolicy) evaluate(hosts []*HostStatus, checkedAt time.Time) *Readiness {
+	r := &Readiness{
+		Ready:     true,
+		Policy:    p.mode,
+		CheckedAt: checkedAt,
+		Hosts:     make([]HostHealth, 0, len(hosts)),
+	}
+
+	reachable := map[string]bool{}
+	unreachable := []string{}
+	for _, h := range hosts {
+		r.Hosts = append(r.Hosts, HostHealth{Name: h.Name, Reachable: h.Reachable})
+		reachable[h.Name] = h.Reachable
+		if !h.Reachable {
+			unreachable = append(unreachable, h.Name)
+		}
+	}
+
+	for _, name := range p.required {
+		if !reachable[name] {
+			r.Ready = false
+			r.Reason = fmt.Sprintf("required host %s is not reachable", name)
+			return r
+		}
+	}
+
+	if len(hosts) == 0 {
+		return r
+	}
+
+	switch p.mode {
+	case readyPolicyAll:
+		if len(unreachable) > 0 {
+			r.Ready = false
+			r.Reason = fmt.Sprintf("hosts not reachable: %s", strings.Join(unreachable, ", "))
+		}
+	case readyPolicyAny:
+		if len(unreachable) == len(hosts) {
+			r.Ready = false
+			r.Reason = "no hosts are reachable"
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/ltm"
+)
+
+func TestNewReadinessPolicy(t *testing.T) {
+	p, err := newReadinessPolicy(common.HealthConfig{})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if p.mode != readyPolicyAny {
+		t.Errorf("expected default policy %s, got %s", readyPolicyAny, p.mode)
+	}
+
+	if _, err := newReadinessPolicy(common.HealthConfig{Policy: "most"}); err == nil {
+		t.Error("expected error for invalid policy")
+	}
+}
+
+func TestReadinessPolicyEvaluate(t *testing.T) {
+	up := &HostStatus{Name: "up", Reachable: true}
+	down := &HostStatus{Name: "down"}
+
+	tests := []struct {
+		policy *readinessPolicy
+		hosts  []*HostStatus
+		ready  bool
+	}{
+		{&readinessPolicy{mode: readyPolicyAny}, []*HostStatus{}, true},
+		{&readinessPolicy{mode: readyPolicyAny}, []*HostStatus{up, down}, true},
+		{&readinessPolicy{mode: readyPolicyAny}, []*HostStatus{down}, false},
+		{&readinessPolicy{mode: readyPolicyAll}, []*HostStatus{up}, true},
+		{&readinessPolicy{mode: readyPolicyAll}, []*HostStatus{up, down}, false},
+		{&readinessPolicy{mode: readyPolicyAny, required: []string{"up"}}, []*HostStatus{up, down}, true},
+		{&readinessPolicy{mode: readyPolicyAny, required: []string{"down"}}, []*HostStatus{up, down}, false},
+		{&readinessPolicy{mode: readyPolicyAny, required: []string{"missing"}}, []*HostStatus{up}, false},
+	}
+
+	for i, test := range tests {
+		out := test.policy.evaluate(test.hosts, time.Now())
+		if out.Ready != test.ready {
+			t.Errorf("test %d: expected ready %t, got %t (%s)", i, test.ready, out.Ready, out.Reason)
+		}
+
+		if !out.Ready && out.Reason == "" {
+			t.Errorf("test %d: expected a reason when not ready", i)
+		}
+	}
+}
+
+func TestHostMonitorStatusCache(t *testing.T) {
+	client := newMockLTM(t)
+	m := newHostMonitor(nil)
+	m.cacheTTL = time.Hour
+
+	services := map[string]ltm.LTMIface{"ltm.example.org": client}
+	first, checkedAt := m.status(context.TODO(), services)
+	if !first[0].Reachable {
+		t.Fatalf("expected reachable host, got %+v", first[0])
+	}
+
+	client.deviceErr = errors.New("connection refused")
+	second, cachedAt := m.status(context.TODO(), services)
+	if !second[0].Reachable || !cachedAt.Equal(checkedAt) {
+		t.Errorf("expected cached status, got %+v", second[0])
+	}
+
+	m.cacheTTL = 0
+	third, _ := m.status(context.TODO(), services)
+	if third[0].Reachable {
+		t.Errorf("expected fresh status after the cache expired, got %+v", third[0])
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	client := newMockLTM(t)
+	srv := newTestServer(t, client)
+
+	if resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/ready", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	client.deviceErr = errors.New("connection refused")
+	srv = newTestServer(t, client)
+
+	if resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/ready", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/health", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// the public endpoints only say whether each host is up
+	out := struct {
+		Data map[string]interface{} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, ok := out.Data["hosts"].([]interface{})
+	if !ok || len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %+v", out.Data)
+	}
+
+	host, _ := hosts[0].(map[string]interface{})
+	if len(host) != 2 || host["name"] != "ltm.example.org" || host["reachable"] != false {
+		t.Errorf("expected only the name and reachability of the host, got %+v", host)
+	}
+}
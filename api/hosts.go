@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/ltm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultProbeTimeout is how long to wait for an ltm to respond to a status probe
+	defaultProbeTimeout = 5 * time.Second
+	// defaultProbeCacheTTL is how long probe results are reused
+	defaultProbeCacheTTL = 10 * time.Second
+)
+
+// HostStatus is the status of a configured ltm host
+type HostStatus struct {
+	Name          string     `json:"name"`
+	Address       string     `json:"address"`
+	Reachable     bool       `json:"reachable"`
+	Version       string     `json:"version,omitempty"`
+	FailoverState string     `json:"failoverState,omitempty"`
+	LastContact   *time.Time `json:"lastContact,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	// CertificateError is set when the ltm's certificate couldn't be verified
+	CertificateError string `json:"certificateError,omitempty"`
+	// Save is the status of saving the ltm's configuration, it's set after the ltm is changed
+	Save *SaveStatus `json:"save,omitempty"`
+}
+
+// hostMonitor probes the configured ltm hosts and keeps track of when each was last contacted
+type hostMonitor struct {
+	mu          sync.Mutex
+	probeMu     sync.Mutex
+	addresses   map[string]string
+	lastContact map[string]time.Time
+	timeout     time.Duration
+	cacheTTL    time.Duration
+	cached      []*HostStatus
+	checkedAt   time.Time
+	// context is the context the shared probes run with, so a caller that gives up doesn't
+	// cancel the probes for everyone else
+	context context.Context
+	// round is the probe in progress
+	round *probeRound
+}
+
+// probeRound is a round of probes shared by the callers waiting for it
+type probeRound struct {
+	done      chan struct{}
+	hosts     []*HostStatus
+	checkedAt time.Time
+}
+
+// newHostMonitor creates a host monitor for the given map of account names to ltm addresses
+func newHostMonitor(addresses map[string]string) *hostMonitor {
+	return &hostMonitor{
+		addresses:   addresses,
+		lastContact: make(map[string]time.Time),
+		timeout:     defaultProbeTimeout,
+		cacheTTL:    defaultProbeCacheTTL,
+		context:     context.Background(),
+	}
+}
+
+// setAddresses replaces the map of account names to ltm addresses after the configuration is
+// reloaded.  Cached results are discarded, the results of a probe in progress aren't cached and
+// removed hosts are forgotten.
+func (m *hostMonitor) setAddresses(addresses map[string]string) {
+	m.probeMu.Lock()
+	defer m.probeMu.Unlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addresses = addresses
+	for name := range m.lastContact {
+		if _, ok := addresses[name]; !ok {
+			delete(m.lastContact, name)
+		}
+	}
+
+	m.cached = nil
+	m.round = nil
+}
+
+// status returns the status of all of the ltm services and when they were checked.  The results
+// are cached for the cache TTL and concurrent callers share a single round of probes, which runs
+// with the monitor's context.  Cancelling ctx only stops the caller waiting for the probes, the
+// hosts are returned as unchecked.
+func (m *hostMonitor) status(ctx context.Context, services map[string]ltm.LTMIface) ([]*HostStatus, time.Time) {
+	m.probeMu.Lock()
+	if m.cached != nil && time.Since(m.checkedAt) < m.cacheTTL {
+		defer m.probeMu.Unlock()
+		return m.cached, m.checkedAt
+	}
+
+	round := m.round
+	if round == nil {
+		round = &probeRound{done: make(chan struct{})}
+		m.round = round
+
+		go func() {
+			hosts := m.probe(m.context, services)
+
+			m.probeMu.Lock()
+			round.hosts = hosts
+			round.checkedAt = time.Now().UTC()
+			if m.round == round {
+				m.cached = round.hosts
+				m.checkedAt = round.checkedAt
+				m.round = nil
+			}
+			m.probeMu.Unlock()
+
+			close(round.done)
+		}()
+	}
+	m.probeMu.Unlock()
+
+	select {
+	case <-round.done:
+		return round.hosts, round.checkedAt
+	case <-ctx.Done():
+		log.Warnf("stopped waiting for the ltm host probes: %s", ctx.Err())
+		return m.unchecked(services, ctx.Err()), time.Now().UTC()
+	}
+}
+
+// unchecked returns the status of the ltm services when the caller stopped waiting for the probes
+func (m *hostMonitor) unchecked(services map[string]ltm.LTMIface, err error) []*HostStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]*HostStatus, 0, len(services))
+	for name := range services {
+		status := &HostStatus{
+			Name:    name,
+			Address: m.addresses[name],
+			Error:   fmt.Sprintf("stopped waiting for response: %s", err),
+		}
+		if t, ok := m.lastContact[name]; ok {
+			status.LastContact = &t
+		}
+		out = append(out, status)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// probe gets the status of all of the ltm services in parallel, sorted by name
+func (m *hostMonitor) probe(ctx context.Context, services map[string]ltm.LTMIface) []*HostStatus {
+	out := make([]*HostStatus, 0, len(services))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for name, service := range services {
+		wg.Add(1)
+		go func(name string, service ltm.LTMIface) {
+			defer wg.Done()
+
+			status := m.probeHost(ctx, name, service)
+
+			mu.Lock()
+			out = append(out, status)
+			mu.Unlock()
+		}(name, service)
+	}
+	wg.Wait()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	return out
+}
+
+// probeHost gets the status of a single ltm, giving up after the probe timeout
+func (m *hostMonitor) probeHost(ctx context.Context, name string, service ltm.LTMIface) *HostStatus {
+	status := &HostStatus{
+		Name: name,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	type result struct {
+		device *ltm.DeviceStatus
+		err    error
+	}
+
+	// the ltm client doesn't take a context, so the probe is abandoned on timeout
+	done := make(chan result, 1)
+	go func() {
+		device, err := service.GetDeviceStatus()
+		done <- result{device, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Warnf("timeout probing ltm host %s", name)
+		status.Error = "timeout waiting for response"
+	case r := <-done:
+		if r.err != nil {
+			log.Warnf("failed to probe ltm host %s: %s", name, r.err)
+			status.Error = r.err.Error()
+			if cerr := ltm.CertificateError(r.err); cerr != nil {
+				status.CertificateError = cerr.Error()
+			}
+		} else {
+			status.Reachable = true
+			status.Version = r.device.Version
+			status.FailoverState = r.device.FailoverState
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status.Address = m.addresses[name]
+
+	if status.Reachable {
+		m.lastContact[name] = time.Now().UTC()
+	}
+
+	if t, ok := m.lastContact[name]; ok {
+		status.LastContact = &t
+	}
+
+	return status
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/ltm"
+)
+
+// slowLTM is an ltm that doesn't respond to status probes until released
+type slowLTM struct {
+	*mockLTM
+	release chan struct{}
+}
+
+func (s *slowLTM) GetDeviceStatus() (*ltm.DeviceStatus, error) {
+	<-s.release
+	return s.mockLTM.GetDeviceStatus()
+}
+
+func TestHostMonitorProbe(t *testing.T) {
+	up := newMockLTM(t)
+	down := newMockLTM(t)
+	down.deviceErr = errors.New("HTTP 401 :: Authentication failed")
+	slow := &slowLTM{mockLTM: newMockLTM(t), release: make(chan struct{})}
+	defer close(slow.release)
+
+	m := newHostMonitor(map[string]string{
+		"up":   "ltm1.example.org",
+		"down": "ltm2.example.org",
+		"slow": "ltm3.example.org",
+	})
+	m.timeout = 50 * time.Millisecond
+
+	services := map[string]ltm.LTMIface{"up": up, "down": down, "slow": slow}
+	out := m.probe(context.TODO(), services)
+
+	if len(out) != 3 || out[0].Name != "down" || out[1].Name != "slow" || out[2].Name != "up" {
+		t.Fatalf("expected status of down, slow and up hosts, got %+v", out)
+	}
+
+	if out[0].Reachable || out[0].Error == "" || out[0].LastContact != nil {
+		t.Errorf("expected down host to be unreachable, got %+v", out[0])
+	}
+
+	if out[1].Reachable || out[1].Error == "" {
+		t.Errorf("expected slow host to time out, got %+v", out[1])
+	}
+
+	if !out[2].Reachable || out[2].Address != "ltm1.example.org" || out[2].Version != "15.1.2" ||
+		out[2].FailoverState != "ACTIVE" || out[2].LastContact == nil {
+		t.Errorf("unexpected status for up host %+v", out[2])
+	}
+
+	// the last contact is kept when a host becomes unreachable
+	up.deviceErr = errors.New("connection refused")
+	out = m.probe(context.TODO(), map[string]ltm.LTMIface{"up": up})
+	if out[0].Reachable || out[0].LastContact == nil {
+		t.Errorf("expected unreachable host with last contact, got %+v", out[0])
+	}
+
+	if out[0].CertificateError != "" {
+		t.Errorf("expected no certificate error, got %s", out[0].CertificateError)
+	}
+
+	// certificate verification failures are reported separately
+	pinErr := &ltm.PinError{Expected: "expected", Actual: "actual"}
+	up.deviceErr = apierror.New(apierror.ErrInternalError, "failed to get sys/version", &url.Error{Op: "Get", URL: "https://ltm1.example.org", Err: pinErr})
+	out = m.probe(context.TODO(), map[string]ltm.LTMIface{"up": up})
+	if out[0].Reachable || out[0].CertificateError != pinErr.Error() {
+		t.Errorf("expected certificate error %q, got %+v", pinErr, out[0])
+	}
+}
+
+func TestListHosts(t *testing.T) {
+	srv := newTestServer(t, newMockLTM(t))
+
+	resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/hosts", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	out := struct {
+		Data []HostStatus `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Data) != 1 || out.Data[0].Name != "ltm.example.org" || !out.Data[0].Reachable {
+		t.Errorf("unexpected hosts %+v", out.Data)
+	}
+}
+
+func TestHostMonitorStatusCancelled(t *testing.T) {
+	slow := &slowLTM{mockLTM: newMockLTM(t), release: make(chan struct{})}
+	m := newHostMonitor(map[string]string{"slow": "ltm1.example.org"})
+	services := map[string]ltm.LTMIface{"slow": slow}
+
+	// a caller that gives up only stops its own wait
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	out, _ := m.status(ctx, services)
+	if len(out) != 1 || out[0].Reachable || out[0].Error == "" {
+		t.Errorf("expected the host to be unchecked for the cancelled caller, got %+v", out)
+	}
+
+	close(slow.release)
+
+	out, _ = m.status(context.Background(), services)
+	if len(out) != 1 || !out[0].Reachable {
+		t.Errorf("expected the shared probe to finish, got %+v", out)
+	}
+
+	// the result is cached for the next caller
+	slow.deviceErr = errors.New("connection refused")
+	if out, _ = m.status(context.Background(), services); len(out) != 1 || !out[0].Reachable {
+		t.Errorf("expected the cached result, got %+v", out)
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// idempotencyHeader is the request header carrying the client supplied idempotency key
+	idempotencyHeader = "Idempotency-Key"
+	// idempotencyReservationTimeout is how long a key is reserved for a request that's still
+	// being processed before it's assumed to have been abandoned
+	idempotencyReservationTimeout = 10 * time.Minute
+	// idempotencyMaxKeys is the most keys stored for each caller
+	idempotencyMaxKeys = 1000
+	// idempotencyMaxEntries is the most keys stored for all callers
+	idempotencyMaxEntries = 10000
+	// idempotencyMaxBody is the largest response body that's stored
+	idempotencyMaxBody = 64 << 10
+)
+
+// replayedHeaders are the response headers set by the API that are stored and replayed, the
+// others (ie. the CORS headers) are set for each request by the middleware
+var replayedHeaders = []string{"Content-Type", "Location"}
+
+// idempotencyKey is a client supplied idempotency key, scoped to the identity that supplied it
+// so one client's key can't replay another client's response
+type idempotencyKey struct {
+	identity string
+	key      string
+}
+
+// idempotentResult is the stored result of the first request made with an idempotency key
+type idempotentResult struct {
+	fingerprint string
+	done        bool
+	reserved    time.Time
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyStore keeps the results of mutating requests keyed by their idempotency key
+// so that retried requests are replayed instead of being applied twice
+type idempotencyStore struct {
+	mu         sync.Mutex
+	results    map[idempotencyKey]*idempotentResult
+	counts     map[string]int
+	window     time.Duration
+	maxKeys    int
+	maxEntries int
+	maxBody    int
+	lastPrune  time.Time
+}
+
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		results:    make(map[idempotencyKey]*idempotentResult),
+		counts:     make(map[string]int),
+		window:     window,
+		maxKeys:    idempotencyMaxKeys,
+		maxEntries: idempotencyMaxEntries,
+		maxBody:    idempotencyMaxBody,
+	}
+}
+
+// Middleware replays the stored response for PUT, POST, PATCH and DELETE requests that
+// carry an idempotency key which has already been used within the window.  A key reused
+// with a different request is rejected with 422 Unprocessable Entity and a key whose first
+// request is still being processed is rejected with 409 Conflict.  Keys are scoped to the
+// authenticated identity.  A caller that has used too many keys in the window is rejected with
+// 429 Too Many Requests, and responses with a large body aren't stored.
+func (s *idempotencyStore) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(idempotencyHeader)
+		if header == "" || !isMutating(r.Method) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := idempotencyKey{identity: identityName(r.Context()), key: header}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			handleError(w, apierror.New(apierror.ErrBadRequest, "failed to read request body", err))
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+
+		result, reservation, err := s.reserve(key, fingerprint)
+		if err != nil {
+			log.Warnf("rejecting idempotency key %s for %s: %s", key.key, key.identity, err)
+			handleError(w, err)
+			return
+		}
+
+		if reservation == nil {
+			switch {
+			case result.fingerprint != fingerprint:
+				log.Warnf("idempotency key %s reused with a different request by %s", key.key, key.identity)
+				writeError(w, http.StatusUnprocessableEntity, "UnprocessableEntity", "idempotency key has already been used with a different request", nil)
+			case !result.done:
+				log.Warnf("idempotency key %s is already being processed for %s", key.key, key.identity)
+				handleError(w, apierror.New(apierror.ErrConflict, "a request with this idempotency key is already in progress", nil))
+			default:
+				log.Infof("replaying response for idempotency key %s for %s", key.key, key.identity)
+				for k, v := range result.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(result.status)
+				w.Write(result.body)
+			}
+			return
+		}
+
+		// the reservation is released if the handler panics, so the key can be retried
+		defer func() {
+			if p := recover(); p != nil {
+				s.release(key, reservation)
+				panic(p)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		// server errors are not stored so the client can retry them
+		if rec.status >= http.StatusInternalServerError {
+			s.release(key, reservation)
+			return
+		}
+
+		if rec.body.Len() > s.maxBody {
+			log.Warnf("not storing the %d byte response for idempotency key %s for %s", rec.body.Len(), key.key, key.identity)
+			s.release(key, reservation)
+			return
+		}
+
+		replay := http.Header{}
+		for _, k := range replayedHeaders {
+			if v := w.Header().Values(k); len(v) > 0 {
+				replay[k] = append([]string(nil), v...)
+			}
+		}
+
+		s.complete(key, reservation, rec.status, replay, rec.body.Bytes())
+	})
+}
+
+// reserve returns the existing result for the key, or reserves the key for a new request and
+// returns the reservation.  It returns an error if the caller or the store has too many keys.
+func (s *idempotencyStore) reserve(key idempotencyKey, fingerprint string) (idempotentResult, *idempotentResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	if result, ok := s.results[key]; ok {
+		if !result.expired(now) {
+			return *result, nil, nil
+		}
+		s.remove(key)
+	}
+
+	if s.counts[key.identity] >= s.maxKeys || len(s.results) >= s.maxEntries {
+		// expired results are only pruned once a minute, so they're removed before giving up
+		s.removeExpired(now)
+
+		if s.counts[key.identity] >= s.maxKeys || len(s.results) >= s.maxEntries {
+			return idempotentResult{}, nil, apierror.New(apierror.ErrLimitExceeded, "too many idempotency keys in use, retry later", nil)
+		}
+	}
+
+	reservation := &idempotentResult{
+		fingerprint: fingerprint,
+		reserved:    now,
+		expires:     now.Add(s.window),
+	}
+	s.results[key] = reservation
+	s.counts[key.identity]++
+
+	return idempotentResult{}, reservation, nil
+}
+
+// complete stores the response for the key, unless the reservation has been replaced
+func (s *idempotencyStore) complete(key idempotencyKey, reservation *idempotentResult, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.results[key]
+	if !ok || result != reservation {
+		return
+	}
+
+	result.done = true
+	result.status = status
+	result.header = header
+	result.body = body
+	result.expires = time.Now().Add(s.window)
+}
+
+// release removes the reservation for the key, unless it has been replaced
+func (s *idempotencyStore) release(key idempotencyKey, reservation *idempotentResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.results[key] == reservation {
+		s.remove(key)
+	}
+}
+
+// remove deletes the result for the key, it must be called with the lock held
+func (s *idempotencyStore) remove(key idempotencyKey) {
+	delete(s.results, key)
+
+	s.counts[key.identity]--
+	if s.counts[key.identity] <= 0 {
+		delete(s.counts, key.identity)
+	}
+}
+
+// prune removes expired results and abandoned reservations at most once a minute.  It must be
+// called with the lock held.
+func (s *idempotencyStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+
+	s.removeExpired(now)
+}
+
+// removeExpired removes expired results and abandoned reservations.  It must be called with the
+// lock held.
+func (s *idempotencyStore) removeExpired(now time.Time) {
+	for k, v := range s.results {
+		if v.expired(now) {
+			s.remove(k)
+		}
+	}
+}
+
+// expired returns true if the result is past the window, or if the request it was reserved for
+// is still in progress after the reservation timeout
+func (r *idempotentResult) expired(now time.Time) bool {
+	if !r.done {
+		return now.Sub(r.reserved) > idempotencyReservationTimeout
+	}
+	return now.After(r.expires)
+}
+
+// requestFingerprint identifies a request by its method, URI and body
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("%s %s %s", r.Method, r.URL.RequestURI(), hex.EncodeToString(sum[:]))
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPut, http.MethodPost, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder is an http.ResponseWriter that keeps a copy of the status and body
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
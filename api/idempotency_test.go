@@ -0,0 +1,290 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	var calls int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", "/create/"+strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+
+	// the CORS headers are set for each request before the idempotency middleware
+	cors := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if origin := r.Header.Get("Origin"); origin != "" {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Vary", "Origin")
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	store := newIdempotencyStore(time.Hour)
+	srv := httptest.NewServer(cors(store.Middleware(handler)))
+	defer srv.Close()
+
+	origin := ""
+	do := func(method, path, key, body string) *http.Response {
+		req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(idempotencyHeader, key)
+		}
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	origin = "https://one.example.org"
+	resp := do(http.MethodPut, "/create", "key1", "foo")
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, resp.StatusCode)
+	}
+
+	// duplicate request is replayed, with the CORS headers for the retry
+	origin = "https://two.example.org"
+	resp = do(http.MethodPut, "/create", "key1", "foo")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated || string(body) != "foo" {
+		t.Errorf("expected replayed response 201 foo, got %d %s", resp.StatusCode, string(body))
+	}
+
+	if resp.Header.Get("Idempotent-Replayed") != "true" || resp.Header.Get("Location") != "/create/1" {
+		t.Errorf("expected replayed headers, got %+v", resp.Header)
+	}
+
+	if resp.Header.Get("Access-Control-Allow-Origin") != origin || len(resp.Header.Values("Vary")) != 1 {
+		t.Errorf("expected the CORS headers for %s, got %+v", origin, resp.Header)
+	}
+
+	origin = ""
+	resp = do(http.MethodPut, "/create", "key1", "foo")
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected no CORS headers without an origin, got %+v", resp.Header)
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 1 {
+		t.Errorf("expected handler to be called once, got %d", c)
+	}
+
+	// same key with a different body
+	resp = do(http.MethodPut, "/create", "key1", "bar")
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d for mismatched body, got %d", http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	// same key with a different path
+	resp = do(http.MethodPut, "/update", "key1", "foo")
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected status %d for mismatched path, got %d", http.StatusUnprocessableEntity, resp.StatusCode)
+	}
+
+	// requests without a key or with safe methods are not stored
+	do(http.MethodPut, "/create", "", "foo")
+	do(http.MethodGet, "/create", "key2", "")
+	do(http.MethodGet, "/create", "key2", "")
+	if c := atomic.LoadInt32(&calls); c != 4 {
+		t.Errorf("expected handler to be called 4 times, got %d", c)
+	}
+
+	// server errors are not stored
+	do(http.MethodPost, "/fail", "key3", "foo")
+	do(http.MethodPost, "/fail", "key3", "foo")
+	if c := atomic.LoadInt32(&calls); c != 6 {
+		t.Errorf("expected handler to be called 6 times, got %d", c)
+	}
+
+	// expired results are not replayed
+	store.mu.Lock()
+	store.results[idempotencyKey{identity: "anonymous", key: "key1"}].expires = time.Now().Add(-time.Second)
+	store.mu.Unlock()
+
+	resp = do(http.MethodPut, "/create", "key1", "foo")
+	if resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Error("expected expired idempotency key not to be replayed")
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+	key := idempotencyKey{identity: "anonymous", key: "key"}
+
+	if _, reservation, _ := store.reserve(key, "PUT /foo abc"); reservation == nil {
+		t.Fatal("expected new key to be reserved")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/foo", strings.NewReader(""))
+	req.Header.Set(idempotencyHeader, "key")
+
+	// force the fingerprint to match the reservation
+	store.mu.Lock()
+	store.results[key].fingerprint = requestFingerprint(req, []byte{})
+	store.mu.Unlock()
+
+	store.Middleware(http.NotFoundHandler()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status %d for in progress key, got %d", http.StatusConflict, rr.Code)
+	}
+
+	// an abandoned reservation is replaced
+	store.mu.Lock()
+	store.results[key].reserved = time.Now().Add(-idempotencyReservationTimeout - time.Second)
+	store.mu.Unlock()
+
+	rr = httptest.NewRecorder()
+	store.Middleware(http.NotFoundHandler()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for abandoned key, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestIdempotencyPanic(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+
+	panics := true
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest(http.MethodPut, "/foo", strings.NewReader("foo"))
+	req.Header.Set(idempotencyHeader, "key")
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected the panic to be passed on, got %v", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	// the key can be retried after the panic
+	panics = false
+	rr := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/foo", strings.NewReader("foo"))
+	req.Header.Set(idempotencyHeader, "key")
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected status %d retrying after a panic, got %d", http.StatusCreated, rr.Code)
+	}
+}
+
+func TestIdempotencyIdentity(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+
+	var calls int32
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(identityName(r.Context())))
+	}))
+
+	do := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/foo", strings.NewReader("foo"))
+		req.Header.Set(idempotencyHeader, "key")
+		req = req.WithContext(withIdentity(req.Context(), &Identity{Name: name}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	do("alice")
+	if rr := do("bob"); rr.Header().Get("Idempotent-Replayed") != "" || rr.Body.String() != "bob" {
+		t.Errorf("expected a key used by another identity not to be replayed, got %s", rr.Body.String())
+	}
+
+	if rr := do("alice"); rr.Header().Get("Idempotent-Replayed") != "true" || rr.Body.String() != "alice" {
+		t.Errorf("expected the key to be replayed for the same identity, got %s", rr.Body.String())
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 2 {
+		t.Errorf("expected handler to be called twice, got %d", c)
+	}
+}
+
+func TestIdempotencyLimits(t *testing.T) {
+	store := newIdempotencyStore(time.Hour)
+	store.maxKeys = 2
+	store.maxEntries = 3
+	store.maxBody = 4
+
+	var calls int32
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+
+	do := func(name, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/foo", strings.NewReader(body))
+		req.Header.Set(idempotencyHeader, key)
+		req = req.WithContext(withIdentity(req.Context(), &Identity{Name: name}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// large responses aren't stored
+	do("alice", "large", "too large")
+	if rr := do("alice", "large", "too large"); rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("expected a large response not to be replayed")
+	}
+
+	// each caller is limited to its own keys
+	do("alice", "one", "foo")
+	do("alice", "two", "foo")
+	if rr := do("alice", "three", "foo"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected %d for too many keys, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	if rr := do("alice", "one", "foo"); rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("expected a stored key to be replayed at the limit")
+	}
+
+	// the store is limited for all callers
+	do("bob", "one", "foo")
+	if rr := do("carol", "one", "foo"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected %d when the store is full, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// expired keys are removed to make room
+	store.mu.Lock()
+	store.results[idempotencyKey{identity: "alice", key: "one"}].expires = time.Now().Add(-time.Second)
+	store.mu.Unlock()
+
+	if rr := do("alice", "three", "foo"); rr.Code != http.StatusCreated {
+		t.Errorf("expected %d after a key expired, got %d", http.StatusCreated, rr.Code)
+	}
+
+	if c := atomic.LoadInt32(&calls); c != 6 {
+		t.Errorf("expected handler to be called 6 times, got %d", c)
+	}
+}
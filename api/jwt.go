@@ -0,0 +1,370 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultJWKSRefresh is how often the key set is fetched from the JWKS URL
+	defaultJWKSRefresh = time.Hour
+	// minJWKSRefresh is the minimum time between fetches when a token has an unknown key id
+	minJWKSRefresh = time.Minute
+)
+
+// jwtAuthenticator validates JWT bearer tokens and maps their groups to access
+type jwtAuthenticator struct {
+	issuer        string
+	audience      string
+	usernameClaim string
+	groupsClaim   string
+	groups        map[string]Access
+	keys          *keySet
+}
+
+// newJWTAuthenticator creates a JWT authenticator from the OIDC configuration and loads the key
+// set.  If the key set is loaded from a URL, it's refreshed in the background until the context
+// is cancelled.
+func newJWTAuthenticator(ctx context.Context, config *common.OIDCConfig) (*jwtAuthenticator, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("oidc issuer and audience are required")
+	}
+
+	if (config.JWKSFile == "") == (config.JWKSURL == "") {
+		return nil, fmt.Errorf("one of oidc jwksFile or jwksURL is required")
+	}
+
+	a := &jwtAuthenticator{
+		issuer:        config.Issuer,
+		audience:      config.Audience,
+		usernameClaim: config.UsernameClaim,
+		groupsClaim:   config.GroupsClaim,
+		groups:        make(map[string]Access),
+		keys: &keySet{
+			file:   config.JWKSFile,
+			url:    config.JWKSURL,
+			client: &http.Client{Timeout: 10 * time.Second},
+		},
+	}
+
+	if a.usernameClaim == "" {
+		a.usernameClaim = "sub"
+	}
+
+	if a.groupsClaim == "" {
+		a.groupsClaim = "groups"
+	}
+
+	for group, c := range config.Groups {
+		access, err := newAccess(c)
+		if err != nil {
+			return nil, fmt.Errorf("oidc group %s: %s", group, err)
+		}
+		a.groups[group] = access
+	}
+
+	if err := a.keys.load(); err != nil {
+		return nil, err
+	}
+
+	if config.JWKSURL != "" {
+		refresh := defaultJWKSRefresh
+		if config.JWKSRefresh != "" {
+			var err error
+			if refresh, err = time.ParseDuration(config.JWKSRefresh); err != nil {
+				return nil, fmt.Errorf("invalid oidc jwks refresh %q: %s", config.JWKSRefresh, err)
+			}
+		}
+
+		go a.keys.refresh(ctx, refresh)
+	}
+
+	return a, nil
+}
+
+// authenticate validates the token signature, issuer, audience and expiration and returns the
+// identity of the caller with the access granted to their groups
+func (a *jwtAuthenticator) authenticate(token string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, a.keys.keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+	if err != nil {
+		return nil, apierror.New(apierror.ErrForbidden, "invalid bearer token", err)
+	}
+
+	name, _ := claims[a.usernameClaim].(string)
+	if name == "" {
+		return nil, apierror.New(apierror.ErrForbidden, fmt.Sprintf("bearer token is missing the %s claim", a.usernameClaim), nil)
+	}
+
+	identity := &Identity{Name: name, Access: []Access{}}
+	for _, g := range claimStrings(claims[a.groupsClaim]) {
+		if access, ok := a.groups[g]; ok {
+			identity.Access = append(identity.Access, access)
+		}
+	}
+
+	if len(identity.Access) == 0 {
+		return nil, apierror.New(apierror.ErrForbidden, fmt.Sprintf("%s is not a member of any authorized group", name), nil)
+	}
+
+	return identity, nil
+}
+
+// claimStrings returns a claim that's either a string or a list of strings as a list
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+
+	return nil
+}
+
+// keySet is a JSON web key set loaded from a file or a URL
+type keySet struct {
+	mu        sync.RWMutex
+	file      string
+	url       string
+	client    *http.Client
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// jsonWebKey is a single RSA or EC public key in a JSON web key set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keyfunc returns the key used to verify the token, from the key id in the token header.  If the
+// key id isn't known and the key set is loaded from a URL, the key set is fetched again.
+func (k *keySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	if key, ok := k.key(kid); ok {
+		return key, nil
+	}
+
+	k.mu.RLock()
+	stale := k.url != "" && time.Since(k.fetchedAt) > minJWKSRefresh
+	k.mu.RUnlock()
+
+	if stale {
+		log.Infof("unknown jwks key id %q, refreshing key set", kid)
+		if err := k.load(); err != nil {
+			return nil, err
+		}
+
+		if key, ok := k.key(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// key returns the key with the key id.  Tokens without a key id are allowed when the key set
+// only has one key.
+func (k *keySet) key(kid string) (crypto.PublicKey, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" && len(k.keys) == 1 {
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// load reads the key set from the file or fetches it from the URL
+func (k *keySet) load() error {
+	var data []byte
+	var err error
+
+	if k.file != "" {
+		data, err = os.ReadFile(k.file)
+	} else {
+		data, err = k.fetch()
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to load jwks: %s", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse jwks: %s", err)
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.fetchedAt = time.Now()
+	k.mu.Unlock()
+
+	kids := make([]string, 0, len(keys))
+	for kid := range keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	log.Infof("loaded jwks with key ids %v", kids)
+
+	return nil
+}
+
+func (k *keySet) fetch() ([]byte, error) {
+	resp, err := k.client.Get(k.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, k.url)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// refresh periodically fetches the key set until the context is cancelled
+func (k *keySet) refresh(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.load(); err != nil {
+				log.Errorf("failed to refresh jwks, keeping the current keys: %s", err)
+			}
+		}
+	}
+}
+
+// parseJWKS parses the RSA and EC signing keys from a JSON web key set
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %s", jwk.Kid, err)
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64BigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64BigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := base64BigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64BigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func base64BigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
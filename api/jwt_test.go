@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testJWKS returns a JSON web key set containing the public keys
+func testJWKS(t *testing.T, keys map[string]interface{}) []byte {
+	t.Helper()
+
+	enc := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	for kid, k := range keys {
+		switch key := k.(type) {
+		case *rsa.PrivateKey:
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   enc(key.N),
+				E:   enc(big.NewInt(int64(key.E))),
+			})
+		case *ecdsa.PrivateKey:
+			set.Keys = append(set.Keys, jsonWebKey{
+				Kty: "EC",
+				Kid: kid,
+				Crv: "P-256",
+				X:   enc(key.X),
+				Y:   enc(key.Y),
+			})
+		}
+	}
+
+	j, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func testJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, testJWKS(t, map[string]interface{}{"rsa": rsaKey, "ec": ecKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &common.OIDCConfig{
+		Issuer:   "https://sso.example.org",
+		Audience: "f5-api",
+		JWKSFile: jwksFile,
+		Groups: map[string]common.AccessConfig{
+			"netops":   {Hosts: []string{"*"}, Objects: []string{"*"}, Scope: "rw"},
+			"helpdesk": {Hosts: []string{"ltm1.example.org"}, Objects: []string{"clientssl"}},
+		},
+	}
+
+	a, err := newJWTAuthenticator(context.TODO(), config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss":    "https://sso.example.org",
+			"aud":    "f5-api",
+			"sub":    "jdoe",
+			"exp":    time.Now().Add(time.Hour).Unix(),
+			"groups": []string{"helpdesk", "unknown"},
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	identity, err := a.authenticate(testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(nil)))
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if identity.Name != "jdoe" || len(identity.Access) != 1 {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	if err := identity.authorize(http.MethodGet, "ltm1.example.org", "clientssl"); err != nil {
+		t.Errorf("expected helpdesk to read ltm1, got %s", err)
+	}
+
+	if err := identity.authorize(http.MethodDelete, "ltm1.example.org", "clientssl"); err == nil {
+		t.Error("expected helpdesk not to delete on ltm1")
+	}
+
+	identity, err = a.authenticate(testJWT(t, jwt.SigningMethodES256, "ec", ecKey, claims(jwt.MapClaims{"groups": "netops"})))
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if err := identity.authorize(http.MethodDelete, "ltm2.example.org", "clientssl"); err != nil {
+		t.Errorf("expected netops to delete on ltm2, got %s", err)
+	}
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := map[string]string{
+		"wrong issuer":   testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"iss": "https://evil.example.org"})),
+		"wrong audience": testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"aud": "other"})),
+		"expired":        testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"missing exp":    testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"exp": nil})),
+		"missing sub":    testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"sub": nil})),
+		"no groups":      testJWT(t, jwt.SigningMethodRS256, "rsa", rsaKey, claims(jwt.MapClaims{"groups": []string{"unknown"}})),
+		"unknown key":    testJWT(t, jwt.SigningMethodRS256, "other", otherKey, claims(nil)),
+		"wrong key":      testJWT(t, jwt.SigningMethodRS256, "rsa", otherKey, claims(nil)),
+		"hmac":           testJWT(t, jwt.SigningMethodHS256, "rsa", []byte("secret"), claims(nil)),
+		"garbage":        "not.a.token",
+	}
+
+	for name, token := range bad {
+		if _, err := a.authenticate(token); err == nil {
+			t.Errorf("expected error for %s token", name)
+		}
+	}
+}
+
+func TestJWTAuthenticatorURL(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var jwks atomic.Value
+	jwks.Store(testJWKS(t, map[string]interface{}{"old": oldKey}))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(jwks.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := newJWTAuthenticator(ctx, &common.OIDCConfig{
+		Issuer:   "https://sso.example.org",
+		Audience: "f5-api",
+		JWKSURL:  srv.URL,
+		Groups:   map[string]common.AccessConfig{"netops": {Hosts: []string{"*"}, Objects: []string{"*"}}},
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	claims := jwt.MapClaims{
+		"iss":    "https://sso.example.org",
+		"aud":    []string{"f5-api"},
+		"sub":    "jdoe",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"netops"},
+	}
+
+	if _, err := a.authenticate(testJWT(t, jwt.SigningMethodRS256, "old", oldKey, claims)); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	// rotate the key, the unknown key id triggers a fetch once the key set is stale
+	jwks.Store(testJWKS(t, map[string]interface{}{"new": newKey}))
+	token := testJWT(t, jwt.SigningMethodRS256, "new", newKey, claims)
+
+	if _, err := a.authenticate(token); err == nil {
+		t.Error("expected error before the key set is stale")
+	}
+
+	a.keys.mu.Lock()
+	a.keys.fetchedAt = time.Now().Add(-2 * minJWKSRefresh)
+	a.keys.mu.Unlock()
+
+	if _, err := a.authenticate(token); err != nil {
+		t.Errorf("expected nil error after refreshing the key set, got %s", err)
+	}
+}
+
+func TestNewJWTAuthenticatorConfig(t *testing.T) {
+	bad := []*common.OIDCConfig{
+		{Audience: "f5-api", JWKSFile: "jwks.json"},
+		{Issuer: "https://sso.example.org", JWKSFile: "jwks.json"},
+		{Issuer: "https://sso.example.org", Audience: "f5-api"},
+		{Issuer: "https://sso.example.org", Audience: "f5-api", JWKSFile: "jwks.json", JWKSURL: "https://sso.example.org/jwks"},
+		{Issuer: "https://sso.example.org", Audience: "f5-api", JWKSFile: "/does/not/exist.json"},
+	}
+
+	for _, c := range bad {
+		if _, err := newJWTAuthenticator(context.TODO(), c); err == nil {
+			t.Errorf("expected error for config %+v", c)
+		}
+	}
+}
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(jwksFile, testJWKS(t, map[string]interface{}{"rsa": key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newJWTAuthenticator(context.TODO(), &common.OIDCConfig{
+		Issuer:   "https://sso.example.org",
+		Audience: "f5-api",
+		JWKSFile: jwksFile,
+		Groups:   map[string]common.AccessConfig{"netops": {Hosts: []string{"*"}, Objects: []string{"*"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var name string
+	srv := httptest.NewServer(tokenMiddleware(&authenticator{jwt: a}, map[string]string{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name = identity(r.Context()).Name
+	})))
+	defer srv.Close()
+
+	token := testJWT(t, jwt.SigningMethodRS256, "rsa", key, jwt.MapClaims{
+		"iss":    "https://sso.example.org",
+		"aud":    "f5-api",
+		"sub":    "jdoe",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"groups": []string{"netops"},
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/private", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || name != "jdoe" {
+		t.Errorf("expected %d for jdoe, got %d for %q", http.StatusOK, resp.StatusCode, name)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected %d for an invalid token, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
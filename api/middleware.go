@@ -1,32 +1,35 @@
 package api
 
 import (
+	"fmt"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
 
+	"github.com/YaleSpinup/apierror"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// TokenMiddleware checks the tokens for non-public URLs
+// TokenMiddleware checks the shared token for non-public URLs
 func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.Handler {
+	return tokenMiddleware(&authenticator{
+		tokens: []apiToken{
+			{psk: psk, identity: &Identity{Name: "default", Access: []Access{fullAccess}}},
+		},
+	}, public, h)
+}
+
+// tokenMiddleware authenticates the caller for non-public URLs and sets their identity on the
+// request context
+func tokenMiddleware(auth *authenticator, public map[string]string, h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Debug("Processing token middleware for protected URLs")
 
-		// Handle CORS preflight checks
-		if r.Method == "OPTIONS" {
-			log.Info("Setting CORS preflight options and returning")
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Headers", "X-Auth-Token")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte{})
-			return
-		}
-
 		uri, err := url.ParseRequestURI(r.RequestURI)
 		if err != nil {
 			log.Error("Unable to parse request URI ", err)
-			w.WriteHeader(http.StatusForbidden)
+			handleError(w, apierror.New(apierror.ErrForbidden, "unable to parse request URI", err))
 			return
 		}
 
@@ -35,16 +38,45 @@ func TokenMiddleware(psk []byte, public map[string]string, h http.Handler) http.
 		} else {
 			log.Debugf("Authenticating token for protected URL '%s'", r.URL)
 
-			htoken := r.Header.Get("X-Auth-Token")
-			if err := bcrypt.CompareHashAndPassword([]byte(htoken), psk); err != nil {
-				log.Warnf("Unable to authenticate session for URL '%s': '%s'", r.URL, err)
-				w.WriteHeader(http.StatusForbidden)
+			// a client that's over the failure limit is rejected before any tokens are checked, only
+			// credentials that were already verified are accepted from it, so another client behind
+			// the same proxy isn't locked out
+			ip := auth.limiter.clientIP(r)
+			if blocked, retry := auth.limiter.blocked(ip); blocked {
+				identity, ok := auth.verified(r)
+				if !ok {
+					log.Warnf("Rejecting request from %s for URL '%s' after too many failed authentication attempts", ip, r.URL)
+					w.Header().Set("Retry-After", fmt.Sprintf("%d", int(math.Ceil(retry.Seconds()))))
+					handleError(w, apierror.New(apierror.ErrLimitExceeded, "too many failed authentication attempts", nil))
+					return
+				}
+
+				log.Infof("Successfully authenticated %s from blocked client %s for URL '%s'", identity.Name, ip, r.URL)
+				h.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), identity)))
 				return
 			}
 
-			log.Infof("Successfully authenticated token for URL '%s'", r.URL)
+			identity, err := auth.authenticate(r)
+			if err != nil {
+				log.Warnf("Unable to authenticate session from %s for URL '%s': %s", ip, r.URL, err)
+				auth.limiter.fail(ip)
+				handleError(w, err)
+				return
+			}
+
+			log.Infof("Successfully authenticated %s for URL '%s'", identity.Name, r.URL)
+			r = r.WithContext(withIdentity(r.Context(), identity))
 		}
 
 		h.ServeHTTP(w, r)
 	})
 }
+
+// remoteIP returns the IP address from the request remote address
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
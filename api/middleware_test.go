@@ -85,25 +85,19 @@ func TestTokenMiddleware(t *testing.T) {
 		t.Errorf("Received %d for '%s/private', expected %d", resp.StatusCode, server.URL, http.StatusOK)
 	}
 
-	// Test a private URL with options
+	// OPTIONS requests are no longer let through without a token, CORS preflight requests are
+	// answered by the CORS middleware before authentication
 	req, _ = http.NewRequest(http.MethodOptions, fmt.Sprintf("%s/optionstuff", server.URL), nil)
 	resp, err = client.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("Received %d for '%s/optionstuff', expected %d", resp.StatusCode, server.URL, http.StatusOK)
-	}
-
-	testHeaders := map[string]string{
-		"Access-Control-Allow-Origin":  "*",
-		"Access-Control-Allow-Headers": "X-Auth-Token",
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Received %d for '%s/optionstuff', expected %d", resp.StatusCode, server.URL, http.StatusForbidden)
 	}
 
-	for k, v := range testHeaders {
-		if h, ok := resp.Header[k]; !ok || h[0] != v {
-			t.Errorf("Expected response header %s from OPTIONS request to be %s, got %s", k, v, h[0])
-		}
+	if h := resp.Header.Get("Access-Control-Allow-Origin"); h != "" {
+		t.Errorf("Expected no Access-Control-Allow-Origin header from the token middleware, got %s", h)
 	}
 }
@@ -2,119 +2,408 @@ package api
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"time"
 
 	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/audit"
+	"github.com/YaleSpinup/f5-api/job"
 	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
 )
 
 type ltmOrchestrator struct {
 	client     ltm.LTMIface
 	org        string
 	UploadPath string
+	tracker    *job.Tracker
+	dryRun     bool
+	plan       []PlannedOperation
+	audit      *audit.Logger
+	saver      *configSaver
+	event      audit.Event
+	// changed is set after a write operation succeeds
+	changed bool
+	// synced is set after the host group is synced
+	synced bool
+	// syncTimeout limits how long to wait for the host group to be in sync, if it's shorter than
+	// the group's sync timeout
+	syncTimeout time.Duration
+	// location is the URL of the object created by the request, it's returned in the Location
+	// header when the request succeeds
+	location string
 }
 
-func (o *ltmOrchestrator) modifyClientSSLProfile(ctx context.Context, data *ModifyClientSSLProfileRequest) error {
-	var err error
-	var ecert []byte
-	var ekey []byte
+// step executes f as the named orchestration step, recording its progress if the
+// orchestrator is running as part of a job
+func (o *ltmOrchestrator) step(name string, f func() error) error {
+	if o.tracker == nil {
+		return f()
+	}
+	return o.tracker.Step(name, f)
+}
 
-	// decode certificate and key file
-	ecert, err = base64.StdEncoding.DecodeString(data.CertificateFile)
-	if err != nil {
-		return err
+// apply executes a write operation against the LTM as an orchestration step.  In dry-run
+// mode the operation is added to the plan and f is never called.
+func (o *ltmOrchestrator) apply(op PlannedOperation, f func() error) error {
+	if o.dryRun {
+		log.Debugf("dry-run: planning %s %s", op.Operation, op.Target)
+		o.plan = append(o.plan, op)
+		return nil
+	}
+
+	err := o.step(op.Step, f)
+	o.record(op, err)
+	if err == nil {
+		o.changed = true
+	}
+	return err
+}
+
+// record adds the outcome of a write operation to the audit log, the event is filled in from
+// the orchestrator's event with the caller, request, host and object
+func (o *ltmOrchestrator) record(op PlannedOperation, err error) {
+	if o.audit == nil {
+		return
+	}
+
+	e := o.event
+	if o.tracker != nil {
+		e.JobID = o.tracker.JobID()
 	}
-	ekey, err = base64.StdEncoding.DecodeString(data.KeyFile)
+	e.Time = time.Now().UTC()
+	e.Step = op.Step
+	e.Action = op.Operation
+	e.Target = op.Target
+	e.Before = audit.Redact(op.Before)
+	e.After = audit.Redact(op.After)
+	e.Outcome = audit.OutcomeSucceeded
 	if err != nil {
-		return err
+		e.Outcome = audit.OutcomeFailed
+		e.Error = err.Error()
 	}
 
-	// TODO Check cert/key match
+	o.audit.Record(e)
+}
 
-	// upload certificate and key file
-	err = o.client.UploadFile(string(ecert), fmt.Sprintf("%s.crt", data.ClientSSLProfileName))
+// certificateAndKey decodes and validates the base64 encoded PEM certificate and key
+func certificateAndKey(certificate, key string) ([]byte, []byte, error) {
+	ecert, err := base64.StdEncoding.DecodeString(certificate)
 	if err != nil {
-		return err
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "certificate is not base64 encoded", err)
 	}
-	err = o.client.UploadFile(string(ekey), fmt.Sprintf("%s.key", data.ClientSSLProfileName))
+
+	ekey, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "key is not base64 encoded", err)
+	}
+
+	block, _ := pem.Decode(ecert)
+	if block == nil {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "certificate is not PEM encoded", nil)
+	}
+
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "failed to parse certificate", err)
+	}
+
+	if _, err := tls.X509KeyPair(ecert, ekey); err != nil {
+		return nil, nil, apierror.New(apierror.ErrBadRequest, "certificate and key do not match", err)
+	}
+
+	return ecert, ekey, nil
+}
+
+// validateClientSSLProfileRequest checks the required fields for creating or replacing a client-ssl profile
+func validateClientSSLProfileRequest(data *ModifyClientSSLProfileRequest) error {
+	if data.ClientSSLProfileName == "" || data.DefaultsFrom == "" || data.Chain == "" || data.CipherGroup == "" || data.Ciphers == "" {
+		return apierror.New(apierror.ErrBadRequest, "clientssl-profile, defaultsfrom, chain, ciphergroup and ciphers are required", nil)
+	}
+	return nil
+}
+
+// getClientSSLProfile gets the client-ssl profile a write is based on.  On a host group it's read
+// from the active unit, since a standby unit may not have the latest changes.
+func (o *ltmOrchestrator) getClientSSLProfile(name string) (*bigip.ClientSSLProfile, error) {
+	group, ok := o.client.(*ltm.Group)
+	if !ok {
+		return o.client.GetClientSSLProfile(name)
+	}
+
+	var out *bigip.ClientSSLProfile
+	err := group.ReadActive(func(l ltm.LTMIface) (err error) {
+		out, err = l.GetClientSSLProfile(name)
 		return err
+	})
+	return out, err
+}
+
+// clientSSLProfileState returns the orchestrated fields of a client-ssl profile from the LTM
+func clientSSLProfileState(p *bigip.ClientSSLProfile) *ClientSSLProfile {
+	if p == nil {
+		return nil
 	}
 
-	thisYear := fmt.Sprintf("%s", time.Now().Format("2006"))
+	return &ClientSSLProfile{
+		ClientSSLProfileName: p.Name,
+		Cert:                 p.Cert,
+		Key:                  p.Key,
+		Chain:                p.Chain,
+		DefaultsFrom:         p.DefaultsFrom,
+		CipherGroup:          p.CipherGroup,
+		Ciphers:              p.Ciphers,
+	}
+}
 
-	err = o.client.ImportCertificate(data.ClientSSLProfileName, thisYear)
+// importCertificateAndKey uploads and imports the certificate and key into System SSL, the
+// imported objects are named for the profile and the year, i.e., realcert.lab.example.org-2021.(crt|key).
+// If rollBackTasks isn't nil, a task to remove each imported object is added to it.
+func (o *ltmOrchestrator) importCertificateAndKey(name string, ecert, ekey []byte, thisYear string, rollBackTasks *[]rollbackFunc) error {
+	err := o.apply(PlannedOperation{
+		Step:      "upload certificate",
+		Operation: "UploadFile",
+		Target:    fmt.Sprintf("%s.crt", name),
+	}, func() error {
+		return o.client.UploadFile(string(ecert), fmt.Sprintf("%s.crt", name))
+	})
 	if err != nil {
 		return err
 	}
 
-	err = o.client.ImportKey(data.ClientSSLProfileName, thisYear)
+	err = o.apply(PlannedOperation{
+		Step:      "upload key",
+		Operation: "UploadFile",
+		Target:    fmt.Sprintf("%s.key", name),
+	}, func() error {
+		return o.client.UploadFile(string(ekey), fmt.Sprintf("%s.key", name))
+	})
 	if err != nil {
 		return err
 	}
 
-	// update clientssl profile, i.e., realcert.lab.example.org-2021.(crt|key)
-	err = o.client.ModifyClientSSLProfile(data.ClientSSLProfileName, data.DefaultsFrom, data.Chain, data.CipherGroup, data.Ciphers, thisYear)
+	err = o.apply(PlannedOperation{
+		Step:      "import certificate",
+		Operation: "ImportCertificate",
+		Target:    fmt.Sprintf("%s-%s.crt", name, thisYear),
+	}, func() error {
+		return o.client.ImportCertificate(name, thisYear)
+	})
 	if err != nil {
 		return err
 	}
 
+	if rollBackTasks != nil {
+		cert := fmt.Sprintf("%s-%s.crt", name, thisYear)
+		*rollBackTasks = append(*rollBackTasks, func(ctx context.Context) error {
+			return o.apply(PlannedOperation{
+				Step:      "rollback import certificate",
+				Operation: "RemoveCertificate",
+				Target:    cert,
+			}, func() error {
+				return o.client.RemoveCertificate(cert)
+			})
+		})
+	}
+
+	err = o.apply(PlannedOperation{
+		Step:      "import key",
+		Operation: "ImportKey",
+		Target:    fmt.Sprintf("%s-%s.key", name, thisYear),
+	}, func() error {
+		return o.client.ImportKey(name, thisYear)
+	})
+	if err != nil {
+		return err
+	}
+
+	if rollBackTasks != nil {
+		key := fmt.Sprintf("%s-%s.key", name, thisYear)
+		*rollBackTasks = append(*rollBackTasks, func(ctx context.Context) error {
+			return o.apply(PlannedOperation{
+				Step:      "rollback import key",
+				Operation: "RemoveKey",
+				Target:    key,
+			}, func() error {
+				return o.client.RemoveKey(key)
+			})
+		})
+	}
+
 	return nil
 }
 
-func (o *ltmOrchestrator) createClientSSLProfile(ctx context.Context, data *ModifyClientSSLProfileRequest) error {
-	var err error
-	var ecert []byte
-	var ekey []byte
+func (o *ltmOrchestrator) modifyClientSSLProfile(ctx context.Context, data *ModifyClientSSLProfileRequest) error {
+	if err := validateClientSSLProfileRequest(data); err != nil {
+		return err
+	}
 
-	// decode certificate and key file
-	ecert, err = base64.StdEncoding.DecodeString(data.CertificateFile)
+	ecert, ekey, err := certificateAndKey(data.CertificateFile, data.KeyFile)
 	if err != nil {
 		return err
 	}
-	ekey, err = base64.StdEncoding.DecodeString(data.KeyFile)
+
+	current, err := o.getClientSSLProfile(data.ClientSSLProfileName)
 	if err != nil {
 		return err
 	}
 
-	// TODO Check cert/key match
+	if current == nil {
+		return apierror.New(apierror.ErrNotFound, fmt.Sprintf("%s not found", data.ClientSSLProfileName), nil)
+	}
 
-	// upload certificate and key file
-	err = o.client.UploadFile(string(ecert), fmt.Sprintf("%s.crt", data.ClientSSLProfileName))
-	if err != nil {
+	thisYear := fmt.Sprintf("%s", time.Now().Format("2006"))
+
+	if err := o.importCertificateAndKey(data.ClientSSLProfileName, ecert, ekey, thisYear, nil); err != nil {
 		return err
 	}
-	err = o.client.UploadFile(string(ekey), fmt.Sprintf("%s.key", data.ClientSSLProfileName))
-	if err != nil {
-		return err
+
+	// update clientssl profile, i.e., realcert.lab.example.org-2021.(crt|key)
+	return o.apply(PlannedOperation{
+		Step:      "modify profile",
+		Operation: "ModifyClientSSLProfile",
+		Target:    data.ClientSSLProfileName,
+		Before:    clientSSLProfileState(current),
+		After: &ClientSSLProfile{
+			ClientSSLProfileName: data.ClientSSLProfileName,
+			Cert:                 fmt.Sprintf("%s-%s.crt", data.ClientSSLProfileName, thisYear),
+			Key:                  fmt.Sprintf("%s-%s.key", data.ClientSSLProfileName, thisYear),
+			Chain:                data.Chain,
+			DefaultsFrom:         data.DefaultsFrom,
+			CipherGroup:          data.CipherGroup,
+			Ciphers:              data.Ciphers,
+		},
+	}, func() error {
+		return o.client.ModifyClientSSLProfile(data.ClientSSLProfileName, data.DefaultsFrom, data.Chain, data.CipherGroup, data.Ciphers, thisYear)
+	})
+}
+
+// patchClientSSLProfile updates only the client-ssl profile settings supplied in the request.  The
+// cert and key are uploaded and imported only if they are supplied.
+func (o *ltmOrchestrator) patchClientSSLProfile(ctx context.Context, data *PatchClientSSLProfileRequest) error {
+	patch := &ltm.ClientSSLProfilePatch{
+		Chain:         data.Chain,
+		DefaultsFrom:  data.DefaultsFrom,
+		CipherGroup:   data.CipherGroup,
+		Ciphers:       data.Ciphers,
+		Renegotiation: data.Renegotiation,
+		SessionTicket: data.SessionTicket,
+		OCSPStapling:  data.OCSPStapling,
+		TLSVersions:   data.TLSVersions,
+	}
+
+	if (data.CertificateFile == "") != (data.KeyFile == "") {
+		return apierror.New(apierror.ErrBadRequest, "cert and key must be supplied together", nil)
 	}
 
+	var ecert, ekey []byte
 	thisYear := fmt.Sprintf("%s", time.Now().Format("2006"))
+	if data.CertificateFile != "" {
+		var err error
+		ecert, ekey, err = certificateAndKey(data.CertificateFile, data.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		cert := fmt.Sprintf("%s-%s.crt", data.ClientSSLProfileName, thisYear)
+		key := fmt.Sprintf("%s-%s.key", data.ClientSSLProfileName, thisYear)
+		patch.Cert = &cert
+		patch.Key = &key
+	}
 
-	err = o.client.ImportCertificate(data.ClientSSLProfileName, thisYear)
+	if err := patch.Validate(); err != nil {
+		return err
+	}
+
+	current, err := o.getClientSSLProfile(data.ClientSSLProfileName)
 	if err != nil {
 		return err
 	}
 
-	err = o.client.ImportKey(data.ClientSSLProfileName, thisYear)
+	if current == nil {
+		return apierror.New(apierror.ErrNotFound, fmt.Sprintf("%s not found", data.ClientSSLProfileName), nil)
+	}
+
+	if ecert != nil {
+		if err := o.importCertificateAndKey(data.ClientSSLProfileName, ecert, ekey, thisYear, nil); err != nil {
+			return err
+		}
+	}
+
+	return o.apply(PlannedOperation{
+		Step:      "patch profile",
+		Operation: "PatchClientSSLProfile",
+		Target:    data.ClientSSLProfileName,
+		Before:    clientSSLProfileState(current),
+		After:     patch,
+	}, func() error {
+		return o.client.PatchClientSSLProfile(data.ClientSSLProfileName, patch)
+	})
+}
+
+func (o *ltmOrchestrator) createClientSSLProfile(ctx context.Context, data *ModifyClientSSLProfileRequest) (err error) {
+	// setup rollback function list and defer execution, the certificate and key are removed
+	// if they were imported but the profile wasn't created
+	var rollBackTasks []rollbackFunc
+	defer func() {
+		if err != nil {
+			log.Errorf("recovering from error creating client-ssl profile: %s", err)
+			rollBack(&rollBackTasks)
+		}
+	}()
+
+	if err := validateClientSSLProfileRequest(data); err != nil {
+		return err
+	}
+
+	ecert, ekey, err := certificateAndKey(data.CertificateFile, data.KeyFile)
 	if err != nil {
 		return err
 	}
 
-	// create clientssl profile, i.e., realcert.lab.example.org-2021.(key|crt}
-	err = o.client.CreateClientSSLProfile(data.ClientSSLProfileName, data.DefaultsFrom, data.Chain, data.CipherGroup, data.Ciphers, thisYear)
+	// an existing profile is checked for before anything is uploaded, since the import would
+	// replace the certificate and key the profile is using
+	current, err := o.getClientSSLProfile(data.ClientSSLProfileName)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if current != nil {
+		return apierror.New(apierror.ErrConflict, fmt.Sprintf("%s already exists", data.ClientSSLProfileName), nil)
+	}
+
+	thisYear := fmt.Sprintf("%s", time.Now().Format("2006"))
+
+	if err := o.importCertificateAndKey(data.ClientSSLProfileName, ecert, ekey, thisYear, &rollBackTasks); err != nil {
+		return err
+	}
+
+	// create clientssl profile, i.e., realcert.lab.example.org-2021.(key|crt}
+	return o.apply(PlannedOperation{
+		Step:      "create profile",
+		Operation: "CreateClientSSLProfile",
+		Target:    data.ClientSSLProfileName,
+		After: &ClientSSLProfile{
+			ClientSSLProfileName: data.ClientSSLProfileName,
+			Cert:                 fmt.Sprintf("%s-%s.crt", data.ClientSSLProfileName, thisYear),
+			Key:                  fmt.Sprintf("%s-%s.key", data.ClientSSLProfileName, thisYear),
+			Chain:                data.Chain,
+			DefaultsFrom:         data.DefaultsFrom,
+			CipherGroup:          data.CipherGroup,
+			Ciphers:              data.Ciphers,
+		},
+	}, func() error {
+		return o.client.CreateClientSSLProfile(data.ClientSSLProfileName, data.DefaultsFrom, data.Chain, data.CipherGroup, data.Ciphers, thisYear)
+	})
 }
 
 func (o *ltmOrchestrator) deleteClientSSLProfile(ctx context.Context, name string) error {
 
-	clientSSLProfile, err := o.client.GetClientSSLProfile(name)
+	clientSSLProfile, err := o.getClientSSLProfile(name)
 	if err != nil {
 		return err
 	}
@@ -123,20 +412,34 @@ func (o *ltmOrchestrator) deleteClientSSLProfile(ctx context.Context, name strin
 		return apierror.New(apierror.ErrNotFound, fmt.Sprintf("%s not found", name), nil)
 	}
 
-	err = o.client.RemoveClientSSLProfile(name)
+	err = o.apply(PlannedOperation{
+		Step:      "remove profile",
+		Operation: "RemoveClientSSLProfile",
+		Target:    name,
+		Before:    clientSSLProfileState(clientSSLProfile),
+	}, func() error {
+		return o.client.RemoveClientSSLProfile(name)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = o.client.RemoveCertificate(clientSSLProfile.Cert)
+	err = o.apply(PlannedOperation{
+		Step:      "remove certificate",
+		Operation: "RemoveCertificate",
+		Target:    clientSSLProfile.Cert,
+	}, func() error {
+		return o.client.RemoveCertificate(clientSSLProfile.Cert)
+	})
 	if err != nil {
 		return err
 	}
 
-	err = o.client.RemoveKey(clientSSLProfile.Key)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return o.apply(PlannedOperation{
+		Step:      "remove key",
+		Operation: "RemoveKey",
+		Target:    clientSSLProfile.Key,
+	}, func() error {
+		return o.client.RemoveKey(clientSSLProfile.Key)
+	})
 }
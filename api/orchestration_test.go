@@ -0,0 +1,444 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
+	"github.com/pkg/errors"
+)
+
+// mockLTM is a fake LTM which records the write calls made against it
+type mockLTM struct {
+	mu           sync.Mutex
+	t            *testing.T
+	profiles     map[string]*bigip.ClientSSLProfile
+	certificates []bigip.Certificate
+	writes       []string
+	failOn       string
+	// getFailsAfter fails GetClientSSLProfile once a write starting with it has been made
+	getFailsAfter string
+	deviceErr     error
+	failover      string
+	syncStatus    string
+}
+
+func newMockLTM(t *testing.T, profiles ...*bigip.ClientSSLProfile) *mockLTM {
+	m := &mockLTM{
+		t:        t,
+		profiles: make(map[string]*bigip.ClientSSLProfile),
+	}
+
+	for _, p := range profiles {
+		m.profiles[p.Name] = p
+	}
+
+	return m
+}
+
+func (m *mockLTM) write(call string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.writes = append(m.writes, call)
+	if m.failOn != "" && strings.HasPrefix(call, m.failOn) {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (m *mockLTM) ListClientSSLProfiles() ([]string, error) {
+	names := []string{}
+	for n := range m.profiles {
+		names = append(names, n)
+	}
+	return names, nil
+}
+
+func (m *mockLTM) ListClientSSLProfileDetails() ([]bigip.ClientSSLProfile, error) {
+	profiles := []bigip.ClientSSLProfile{}
+	for _, p := range m.profiles {
+		profiles = append(profiles, *p)
+	}
+	return profiles, nil
+}
+
+func (m *mockLTM) ListCertificates() ([]bigip.Certificate, error) {
+	return m.certificates, nil
+}
+
+func (m *mockLTM) GetClientSSLProfile(name string) (*bigip.ClientSSLProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getFailsAfter != "" {
+		for _, w := range m.writes {
+			if strings.HasPrefix(w, m.getFailsAfter) {
+				return nil, errors.New("get failed")
+			}
+		}
+	}
+
+	return m.profiles[name], nil
+}
+
+func (m *mockLTM) UploadFile(file, name string) error {
+	return m.write("UploadFile " + name)
+}
+
+func (m *mockLTM) ImportKey(name, year string) error {
+	return m.write(fmt.Sprintf("ImportKey %s-%s", name, year))
+}
+
+func (m *mockLTM) ImportCertificate(name, year string) error {
+	return m.write(fmt.Sprintf("ImportCertificate %s-%s", name, year))
+}
+
+func (m *mockLTM) ModifyClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, year string) error {
+	return m.write("ModifyClientSSLProfile " + name)
+}
+
+func (m *mockLTM) CreateClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, year string) error {
+	return m.write("CreateClientSSLProfile " + name)
+}
+
+func (m *mockLTM) PatchClientSSLProfile(name string, patch *ltm.ClientSSLProfilePatch) error {
+	return m.write("PatchClientSSLProfile " + name)
+}
+
+func (m *mockLTM) RemoveClientSSLProfile(name string) error {
+	return m.write("RemoveClientSSLProfile " + name)
+}
+
+func (m *mockLTM) RemoveKey(name string) error {
+	return m.write("RemoveKey " + name)
+}
+
+func (m *mockLTM) RemoveCertificate(name string) error {
+	return m.write("RemoveCertificate " + name)
+}
+
+func (m *mockLTM) GetDeviceStatus() (*ltm.DeviceStatus, error) {
+	if m.deviceErr != nil {
+		return nil, m.deviceErr
+	}
+	failover := m.failover
+	if failover == "" {
+		failover = "ACTIVE"
+	}
+	return &ltm.DeviceStatus{Version: "15.1.2", FailoverState: failover}, nil
+}
+
+func (m *mockLTM) SyncConfig(deviceGroup string) error {
+	if err := m.write("SyncConfig " + deviceGroup); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.syncStatus == "" {
+		m.syncStatus = ltm.SyncStatusInSync
+	}
+	return nil
+}
+
+func (m *mockLTM) SaveConfig() error {
+	return m.write("SaveConfig")
+}
+
+func (m *mockLTM) GetSyncStatus() (*ltm.SyncStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &ltm.SyncStatus{Status: m.syncStatus, Summary: "sync summary"}, nil
+}
+
+// testCertificateAndKey generates a base64 encoded self-signed certificate and key
+func testCertificateAndKey(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.example.org"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	k := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	return base64.StdEncoding.EncodeToString(cert), base64.StdEncoding.EncodeToString(k)
+}
+
+func testProfileRequest(t *testing.T, name string) *ModifyClientSSLProfileRequest {
+	cert, key := testCertificateAndKey(t)
+	return &ModifyClientSSLProfileRequest{
+		CertificateFile:      cert,
+		KeyFile:              key,
+		ClientSSLProfileName: name,
+		Chain:                "intermediate-chain.crt",
+		DefaultsFrom:         "clientssl",
+		CipherGroup:          "default-tlsv1.2",
+		Ciphers:              "none",
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	existing := &bigip.ClientSSLProfile{
+		Name:         "existing.example.org",
+		Cert:         "/Common/existing.example.org-2020.crt",
+		Key:          "/Common/existing.example.org-2020.key",
+		Chain:        "/Common/intermediate-chain.crt",
+		DefaultsFrom: "/Common/clientssl",
+	}
+
+	thisYear := time.Now().Format("2006")
+
+	type test struct {
+		name     string
+		f        func(o *ltmOrchestrator) error
+		expected []string
+		code     string
+	}
+
+	tests := []test{
+		{
+			name: "create",
+			f: func(o *ltmOrchestrator) error {
+				return o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "new.example.org"))
+			},
+			expected: []string{"UploadFile", "UploadFile", "ImportCertificate", "ImportKey", "CreateClientSSLProfile"},
+		},
+		{
+			name: "create existing",
+			f: func(o *ltmOrchestrator) error {
+				return o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "existing.example.org"))
+			},
+			code: apierror.ErrConflict,
+		},
+		{
+			name: "modify",
+			f: func(o *ltmOrchestrator) error {
+				return o.modifyClientSSLProfile(context.TODO(), testProfileRequest(t, "existing.example.org"))
+			},
+			expected: []string{"UploadFile", "UploadFile", "ImportCertificate", "ImportKey", "ModifyClientSSLProfile"},
+		},
+		{
+			name: "modify missing",
+			f: func(o *ltmOrchestrator) error {
+				return o.modifyClientSSLProfile(context.TODO(), testProfileRequest(t, "missing.example.org"))
+			},
+			code: apierror.ErrNotFound,
+		},
+		{
+			name: "modify invalid certificate",
+			f: func(o *ltmOrchestrator) error {
+				data := testProfileRequest(t, "existing.example.org")
+				data.CertificateFile = base64.StdEncoding.EncodeToString([]byte("not a certificate"))
+				return o.modifyClientSSLProfile(context.TODO(), data)
+			},
+			code: apierror.ErrBadRequest,
+		},
+		{
+			name: "modify mismatched key",
+			f: func(o *ltmOrchestrator) error {
+				data := testProfileRequest(t, "existing.example.org")
+				_, data.KeyFile = testCertificateAndKey(t)
+				return o.modifyClientSSLProfile(context.TODO(), data)
+			},
+			code: apierror.ErrBadRequest,
+		},
+		{
+			name: "delete",
+			f: func(o *ltmOrchestrator) error {
+				return o.deleteClientSSLProfile(context.TODO(), "existing.example.org")
+			},
+			expected: []string{"RemoveClientSSLProfile", "RemoveCertificate", "RemoveKey"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newMockLTM(t, existing)
+			o := &ltmOrchestrator{client: client, dryRun: true}
+
+			err := tc.f(o)
+			if tc.code != "" {
+				aerr, ok := errors.Cause(err).(apierror.Error)
+				if !ok || aerr.Code != tc.code {
+					t.Errorf("expected %s error, got %v", tc.code, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(client.writes) != 0 {
+				t.Errorf("expected no writes in dry-run mode, got %v", client.writes)
+			}
+
+			if len(o.plan) != len(tc.expected) {
+				t.Fatalf("expected %d planned operations, got %+v", len(tc.expected), o.plan)
+			}
+
+			for i, op := range tc.expected {
+				if o.plan[i].Operation != op {
+					t.Errorf("expected planned operation %d to be %s, got %s", i, op, o.plan[i].Operation)
+				}
+			}
+		})
+	}
+
+	// modify plan includes the before and after state of the profile
+	o := &ltmOrchestrator{client: newMockLTM(t, existing), dryRun: true}
+	if err := o.modifyClientSSLProfile(context.TODO(), testProfileRequest(t, "existing.example.org")); err != nil {
+		t.Fatal(err)
+	}
+
+	last := o.plan[len(o.plan)-1]
+	before, ok := last.Before.(*ClientSSLProfile)
+	if !ok || before.Cert != existing.Cert {
+		t.Errorf("expected before state with cert %s, got %+v", existing.Cert, last.Before)
+	}
+
+	after, ok := last.After.(*ClientSSLProfile)
+	if !ok || after.Cert != fmt.Sprintf("existing.example.org-%s.crt", thisYear) {
+		t.Errorf("expected after state with new cert, got %+v", last.After)
+	}
+}
+
+func TestCreateClientSSLProfileConflict(t *testing.T) {
+	existing := &bigip.ClientSSLProfile{Name: "existing.example.org", Cert: "existing.example.org-2020.crt", Key: "existing.example.org-2020.key"}
+	client := newMockLTM(t, existing)
+	o := &ltmOrchestrator{client: client}
+
+	err := o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "existing.example.org"))
+	if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != apierror.ErrConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	// the certificate and key of the existing profile are left alone
+	if len(client.writes) != 0 {
+		t.Errorf("expected no writes, got %v", client.writes)
+	}
+}
+
+func TestGroupReadsActiveUnit(t *testing.T) {
+	// the standby unit has copies of the profiles from before the last changes on the active unit
+	standby := newMockLTM(t,
+		&bigip.ClientSSLProfile{Name: "new.example.org", Cert: "new.example.org-2020.crt", Key: "new.example.org-2020.key"},
+		&bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2020.crt", Key: "www.example.org-2020.key"},
+	)
+	standby.failover = "STANDBY"
+	active := newMockLTM(t,
+		&bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2021.crt", Key: "www.example.org-2021.key"},
+	)
+
+	group := ltm.NewGroup("pair", "sync-failover", []ltm.GroupMember{
+		{Name: "ltm1", Service: standby},
+		{Name: "ltm2", Service: active},
+	})
+	o := &ltmOrchestrator{client: group}
+
+	if err := o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "new.example.org")); err != nil {
+		t.Fatalf("expected the profile removed from the active unit to be created, got %v", err)
+	}
+
+	if err := o.deleteClientSSLProfile(context.TODO(), "www.example.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := strings.Join(active.writes, ",")
+	if !strings.Contains(writes, "RemoveCertificate www.example.org-2021.crt") || !strings.Contains(writes, "RemoveKey www.example.org-2021.key") {
+		t.Errorf("expected the certificate and key of the active unit's profile to be removed, got %v", active.writes)
+	}
+
+	if len(standby.writes) != 0 {
+		t.Errorf("expected no writes on the standby unit, got %v", standby.writes)
+	}
+}
+
+func TestCreateClientSSLProfileRollback(t *testing.T) {
+	client := newMockLTM(t)
+	o := &ltmOrchestrator{client: client}
+
+	if err := o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "new.example.org")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(client.writes) != 5 {
+		t.Errorf("expected 5 writes, got %v", client.writes)
+	}
+
+	thisYear := time.Now().Format("2006")
+	tests := []struct {
+		failOn   string
+		expected []string
+	}{
+		{
+			failOn: "CreateClientSSLProfile",
+			expected: []string{
+				"RemoveKey new.example.org-" + thisYear + ".key",
+				"RemoveCertificate new.example.org-" + thisYear + ".crt",
+			},
+		},
+		{
+			// only the objects that were imported are removed
+			failOn: "ImportKey",
+			expected: []string{
+				"RemoveCertificate new.example.org-" + thisYear + ".crt",
+			},
+		},
+		{
+			failOn:   "ImportCertificate",
+			expected: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		client := newMockLTM(t)
+		client.failOn = test.failOn
+		o := &ltmOrchestrator{client: client}
+
+		if err := o.createClientSSLProfile(context.TODO(), testProfileRequest(t, "new.example.org")); err == nil {
+			t.Errorf("expected error failing on %s, got nil", test.failOn)
+		}
+
+		rollbacks := []string{}
+		for _, w := range client.writes {
+			if strings.HasPrefix(w, "Remove") {
+				rollbacks = append(rollbacks, w)
+			}
+		}
+
+		if strings.Join(rollbacks, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("expected rollback writes %v failing on %s, got %v", test.expected, test.failOn, rollbacks)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+)
+
+// maxListLimit is the largest page size allowed for list endpoints
+const maxListLimit = 1000
+
+// Pagination describes the page of results returned by a list endpoint
+type Pagination struct {
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// listQuery is the set of query conventions shared by the list endpoints
+//
+//	prefix - only return items whose name starts with the prefix
+//	match  - only return items whose name matches the regular expression
+//	sort   - the sort key, prefixed with '-' to sort in descending order
+//	limit  - the maximum number of items to return
+//	cursor - the nextCursor returned by the previous page
+//	expand - return full objects instead of names
+type listQuery struct {
+	prefix  string
+	match   *regexp.Regexp
+	sortKey string
+	desc    bool
+	limit   int
+	offset  int
+	expand  bool
+	filters map[string]string
+}
+
+// parseListQuery parses the list query parameters from the request.  The sort key must be one of the
+// given sort keys and defaults to the first one.  Any of the given filters found in the query are
+// available from the filters map.
+func parseListQuery(r *http.Request, sortKeys []string, filters ...string) (*listQuery, error) {
+	query := r.URL.Query()
+
+	q := &listQuery{
+		prefix:  query.Get("prefix"),
+		filters: map[string]string{},
+	}
+
+	if m := query.Get("match"); m != "" {
+		re, err := regexp.Compile(m)
+		if err != nil {
+			return nil, apierror.New(apierror.ErrBadRequest, "invalid match expression", err)
+		}
+		q.match = re
+	}
+
+	if e := query.Get("expand"); e != "" {
+		expand, err := strconv.ParseBool(e)
+		if err != nil {
+			return nil, apierror.New(apierror.ErrBadRequest, "invalid expand value", err)
+		}
+		q.expand = expand
+	}
+
+	if len(sortKeys) > 0 {
+		q.sortKey = sortKeys[0]
+		if strings.HasPrefix(q.sortKey, "-") {
+			q.sortKey = strings.TrimPrefix(q.sortKey, "-")
+			q.desc = true
+		}
+	}
+
+	if s := query.Get("sort"); s != "" {
+		q.desc = strings.HasPrefix(s, "-")
+		q.sortKey = strings.TrimPrefix(s, "-")
+
+		valid := false
+		for _, k := range sortKeys {
+			if strings.TrimPrefix(k, "-") == q.sortKey {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return nil, apierror.New(apierror.ErrBadRequest, fmt.Sprintf("invalid sort key %s", q.sortKey), nil)
+		}
+	}
+
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxListLimit {
+			return nil, apierror.New(apierror.ErrBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxListLimit), err)
+		}
+		q.limit = limit
+	}
+
+	if c := query.Get("cursor"); c != "" {
+		offset, err := decodeCursor(c)
+		if err != nil {
+			return nil, err
+		}
+		q.offset = offset
+	}
+
+	for _, f := range filters {
+		if v := query.Get(f); v != "" {
+			q.filters[f] = v
+		}
+	}
+
+	return q, nil
+}
+
+// matchName returns true if the name matches the prefix and match expression
+func (q *listQuery) matchName(name string) bool {
+	if q.prefix != "" && !strings.HasPrefix(name, q.prefix) {
+		return false
+	}
+
+	if q.match != nil && !q.match.MatchString(name) {
+		return false
+	}
+
+	return true
+}
+
+// sortItems sorts the items by the query sort key using the matching less function
+func sortItems[T any](q *listQuery, items []T, less map[string]func(a, b T) bool) {
+	f, ok := less[q.sortKey]
+	if !ok {
+		return
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if q.desc {
+			return f(items[j], items[i])
+		}
+		return f(items[i], items[j])
+	})
+}
+
+// paginate returns the page of items selected by the query limit and cursor
+func paginate[T any](q *listQuery, items []T) ([]T, *Pagination) {
+	p := &Pagination{
+		Total: len(items),
+		Limit: q.limit,
+	}
+
+	if q.offset >= len(items) {
+		return []T{}, p
+	}
+
+	page := items[q.offset:]
+	if q.limit > 0 && len(page) > q.limit {
+		page = page[:q.limit]
+		p.NextCursor = encodeCursor(q.offset + q.limit)
+	}
+
+	return page, p
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("offset:%d", offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, apierror.New(apierror.ErrBadRequest, "invalid cursor", err)
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(b), "offset:"))
+	if err != nil || offset < 0 || !strings.HasPrefix(string(b), "offset:") {
+		return 0, apierror.New(apierror.ErrBadRequest, "invalid cursor", err)
+	}
+
+	return offset, nil
+}
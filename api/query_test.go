@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	bigip "github.com/YaleUniversity/go-bigip"
+)
+
+func TestParseListQuery(t *testing.T) {
+	sortKeys := []string{"-createdAt", "host"}
+
+	r := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	q, err := parseListQuery(r, sortKeys, "host")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if q.sortKey != "createdAt" || !q.desc {
+		t.Errorf("expected default sort -createdAt, got %s (desc %t)", q.sortKey, q.desc)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/jobs?sort=host&prefix=foo&match=bar$&limit=10&host=ltm.example.org&expand=true", nil)
+	q, err = parseListQuery(r, sortKeys, "host")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if q.sortKey != "host" || q.desc {
+		t.Errorf("expected sort host, got %s (desc %t)", q.sortKey, q.desc)
+	}
+
+	if q.limit != 10 || !q.expand || q.filters["host"] != "ltm.example.org" {
+		t.Errorf("unexpected query %+v", q)
+	}
+
+	if !q.matchName("foo.bar") || q.matchName("foo.baz") || q.matchName("bar") {
+		t.Error("unexpected name match result")
+	}
+
+	for _, bad := range []string{"sort=name", "limit=0", "limit=1001", "limit=x", "match=(", "cursor=!!", "expand=maybe"} {
+		r := httptest.NewRequest(http.MethodGet, "/jobs?"+bad, nil)
+		if _, err := parseListQuery(r, sortKeys); err == nil {
+			t.Errorf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	items := []int{1, 2, 3, 4, 5}
+
+	q := &listQuery{limit: 2}
+	var got []int
+	for {
+		page, p := paginate(q, items)
+		if p.Total != len(items) {
+			t.Errorf("expected total %d, got %d", len(items), p.Total)
+		}
+		got = append(got, page...)
+
+		if p.NextCursor == "" {
+			break
+		}
+
+		offset, err := decodeCursor(p.NextCursor)
+		if err != nil {
+			t.Fatalf("expected nil error, got %s", err)
+		}
+		q.offset = offset
+	}
+
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("expected %v, got %v", items, got)
+	}
+
+	page, p := paginate(&listQuery{}, items)
+	if len(page) != len(items) || p.NextCursor != "" {
+		t.Errorf("expected all items without a cursor, got %v %+v", page, p)
+	}
+}
+
+func TestListClientSSLProfilesQuery(t *testing.T) {
+	client := newMockLTM(t,
+		&bigip.ClientSSLProfile{Name: "a.example.org", Partition: "Common", Cert: "/Common/a.example.org-2021.crt", DefaultsFrom: "/Common/clientssl"},
+		&bigip.ClientSSLProfile{Name: "b.example.org", Partition: "Common", Cert: "/Common/b.example.org-2021.crt", DefaultsFrom: "/Common/clientssl-secure"},
+		&bigip.ClientSSLProfile{Name: "c.example.com", Partition: "Other", Cert: "/Other/c.example.com-2021.crt", DefaultsFrom: "/Common/clientssl"},
+	)
+	client.certificates = []bigip.Certificate{
+		{Name: "a.example.org-2021.crt", FullPath: "/Common/a.example.org-2021.crt", ExpirationDate: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC).Unix()},
+		{Name: "b.example.org-2021.crt", FullPath: "/Common/b.example.org-2021.crt", ExpirationDate: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+
+	srv := newTestServer(t, client)
+	base := srv.URL + "/v1/f5/ltm.example.org/clientssl"
+
+	type result struct {
+		Data       json.RawMessage `json:"data"`
+		Pagination *Pagination     `json:"pagination"`
+	}
+
+	list := func(query string) ([]string, *Pagination) {
+		t.Helper()
+
+		resp := doRequest(t, http.MethodGet, base+query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %d listing %s, got %d", http.StatusOK, query, resp.StatusCode)
+		}
+
+		out := result{}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+
+		names := []string{}
+		if err := json.Unmarshal(out.Data, &names); err != nil {
+			t.Fatal(err)
+		}
+
+		return names, out.Pagination
+	}
+
+	tests := map[string][]string{
+		"":                                     {"a.example.org", "b.example.org", "c.example.com"},
+		"?sort=-name":                          {"c.example.com", "b.example.org", "a.example.org"},
+		"?prefix=b":                            {"b.example.org"},
+		"?match=\\.org$":                       {"a.example.org", "b.example.org"},
+		"?partition=Other":                     {"c.example.com"},
+		"?defaultsFrom=clientssl":              {"a.example.org", "c.example.com"},
+		"?cert=/Common/b.example.org-2021.crt": {"b.example.org"},
+		"?sort=certExpiration":                 {"b.example.org", "a.example.org", "c.example.com"},
+	}
+
+	for query, expected := range tests {
+		names, _ := list(query)
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected %v for %q, got %v", expected, query, names)
+		}
+	}
+
+	names, p := list("?limit=2")
+	if !reflect.DeepEqual(names, []string{"a.example.org", "b.example.org"}) || p == nil || p.NextCursor == "" || p.Total != 3 {
+		t.Fatalf("unexpected first page %v %+v", names, p)
+	}
+
+	names, p = list("?limit=2&cursor=" + p.NextCursor)
+	if !reflect.DeepEqual(names, []string{"c.example.com"}) || p.NextCursor != "" {
+		t.Errorf("unexpected second page %v %+v", names, p)
+	}
+
+	resp := doRequest(t, http.MethodGet, base+"?expand=true&prefix=a", nil)
+	out := struct {
+		Data []ClientSSLProfileDetail `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Data) != 1 || out.Data[0].Name != "a.example.org" || out.Data[0].CertExpiration == nil ||
+		!out.Data[0].CertExpiration.Equal(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expanded profiles %+v", out.Data)
+	}
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/ltm"
+	log "github.com/sirupsen/logrus"
+)
+
+// ConfigLoader reads the current configuration when it's reloaded
+type ConfigLoader func() (common.Config, error)
+
+// ServerOption configures optional server behavior
+type ServerOption func(*server)
+
+// WithConfigReload reloads the configuration with load when the server receives SIGHUP and, if
+// file is set, when the file changes.  The file is checked every interval.
+func WithConfigReload(load ConfigLoader, file string, interval time.Duration) ServerOption {
+	return func(s *server) {
+		log.Debugf("enabling configuration reload from %s every %s", file, interval)
+		s.loadConfig = load
+		s.configFile = file
+		s.reloadInterval = interval
+	}
+}
+
+// newLTMService creates an LTM session for the account
+func newLTMService(a common.Account) ltm.LTMIface {
+	opts := []ltm.Option{
+		ltm.WithTLSOptions(ltm.TLSOptions{
+			CAFile:             a.TLS.CAFile,
+			PinnedSPKI:         a.TLS.PinnedSPKI,
+			ServerName:         a.TLS.ServerName,
+			InsecureSkipVerify: a.TLS.InsecureSkipVerify,
+		}),
+	}
+
+	if a.Auth == "token" {
+		opts = append(opts, ltm.WithTokenAuth(a.LoginProvider))
+	}
+
+	return ltm.NewSession(a.LTMHost, a.Username, a.Password, a.UploadPath, opts...)
+}
+
+// ltmService returns the LTM service for the host or host group.  The returned service keeps
+// working for the rest of the request even if the host is changed or removed by a reload.
+func (s *server) ltmService(host string) (ltm.LTMIface, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if service, ok := s.LTMServices[host]; ok {
+		return service, true
+	}
+
+	if group, ok := s.groups[host]; ok {
+		return group, true
+	}
+
+	return nil, false
+}
+
+// ltmServices returns a copy of the LTM services for all hosts
+func (s *server) ltmServices() map[string]ltm.LTMIface {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	services := make(map[string]ltm.LTMIface, len(s.LTMServices))
+	for name, service := range s.LTMServices {
+		services[name] = service
+	}
+	return services
+}
+
+// configVersion returns the revision of the loaded configuration and when it was loaded
+func (s *server) configVersion() (string, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.configRevision, s.configLoadedAt
+}
+
+// setHosts creates LTM sessions for new and changed accounts and host groups for new and changed
+// groups, keeps the sessions and groups that haven't changed and swaps in the new set of hosts
+// and groups in one step, so a request never sees the new hosts with the old groups.  It returns
+// the names of the hosts that were added, changed and removed.
+func (s *server) setHosts(accounts map[string]common.Account, hostGroups map[string]common.HostGroup, revision string) (added, changed, removed []string) {
+	newService := s.newLTM
+	if newService == nil {
+		newService = newLTMService
+	}
+
+	// the sessions and groups are built from a copy of the current ones, the configuration is
+	// only changed by the single reload goroutine
+	s.mu.RLock()
+	current := make(map[string]ltm.LTMIface, len(s.LTMServices))
+	for name, service := range s.LTMServices {
+		current[name] = service
+	}
+	currentAccounts := s.accounts
+	currentGroups := s.groups
+	currentGroupConfigs := s.groupConfigs
+	s.mu.RUnlock()
+
+	services := make(map[string]ltm.LTMIface, len(accounts))
+	addresses := make(map[string]string, len(accounts))
+	for name, a := range accounts {
+		addresses[name] = a.LTMHost
+
+		old, ok := currentAccounts[name]
+		if ok && reflect.DeepEqual(old, a) && current[name] != nil {
+			services[name] = current[name]
+			continue
+		}
+
+		if ok {
+			changed = append(changed, name)
+		} else {
+			added = append(added, name)
+		}
+		services[name] = newService(a)
+	}
+
+	for name := range currentAccounts {
+		if _, ok := accounts[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+
+	groups := make(map[string]*ltm.Group, len(hostGroups))
+	for name, g := range hostGroups {
+		if old, ok := currentGroups[name]; ok && reflect.DeepEqual(currentGroupConfigs[name], g) && sameMembers(old, g, services) {
+			groups[name] = old
+			continue
+		}
+		groups[name] = newHostGroup(name, g, services)
+	}
+
+	s.mu.Lock()
+	s.LTMServices = services
+	s.accounts = accounts
+	s.groups = groups
+	s.groupConfigs = hostGroups
+	s.configRevision = revision
+	s.configLoadedAt = time.Now().UTC()
+	s.mu.Unlock()
+
+	if s.hosts != nil {
+		s.hosts.setAddresses(addresses)
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return added, changed, removed
+}
+
+// newHostGroup creates a host group with the sessions of its members
+func newHostGroup(name string, g common.HostGroup, services map[string]ltm.LTMIface) *ltm.Group {
+	members := make([]ltm.GroupMember, 0, len(g.Members))
+	for _, m := range g.Members {
+		service, ok := services[m]
+		if !ok {
+			log.Warnf("host group %s member %s isn't a configured host, skipping", name, m)
+			continue
+		}
+		members = append(members, ltm.GroupMember{Name: m, Service: service})
+	}
+
+	group := ltm.NewGroup(name, g.SyncGroup, members)
+	group.AutoSync = g.AutoSync
+	if d, err := time.ParseDuration(g.SyncTimeout); err == nil && d > 0 {
+		group.SyncTimeout = d
+	}
+
+	return group
+}
+
+// sameMembers returns true if the group has the same members with the same sessions it would be
+// created with, so it can be kept along with its active unit
+func sameMembers(group *ltm.Group, g common.HostGroup, services map[string]ltm.LTMIface) bool {
+	members := group.MemberServices()
+
+	i := 0
+	for _, name := range g.Members {
+		service, ok := services[name]
+		if !ok {
+			continue
+		}
+
+		if i >= len(members) || members[i].Name != name || members[i].Service != service {
+			return false
+		}
+		i++
+	}
+
+	return i == len(members)
+}
+
+// reload loads the configuration and applies the account and host group changes
+func (s *server) reload() error {
+	config, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	if s.secrets != nil {
+		// the secrets settings are reloaded too, so a changed region, role or external id is used
+		s.secrets.params = s.parameterStore(config.Secrets)
+		if err := s.secrets.resolve(s.context, &config); err != nil {
+			return fmt.Errorf("failed to resolve secrets: %s", err)
+		}
+	}
+
+	if err := config.SetRevision(); err != nil {
+		return err
+	}
+
+	added, changed, removed := s.setHosts(config.Accounts, config.HostGroups, config.Revision)
+	log.Infof("reloaded configuration %s, added hosts: %v, changed hosts: %v, removed hosts: %v", config.Revision, added, changed, removed)
+
+	return nil
+}
+
+// watchConfig reloads the configuration on SIGHUP and when the configuration file changes, until
+// the context is cancelled.  A configuration that fails to load is logged and the current
+// configuration is kept.
+func (s *server) watchConfig(ctx context.Context) {
+	if s.loadConfig == nil {
+		return
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	var modTime time.Time
+	if s.configFile != "" && s.reloadInterval > 0 {
+		ticker := time.NewTicker(s.reloadInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+
+		modTime, _ = latestModTime(s.configFile)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info("received SIGHUP, reloading configuration")
+		case <-tick:
+			latest, err := latestModTime(s.configFile)
+			if err != nil {
+				log.Errorf("failed to check configuration file: %s", err)
+				continue
+			}
+
+			if !latest.After(modTime) {
+				continue
+			}
+			modTime = latest
+
+			log.Infof("configuration file %s changed, reloading configuration", s.configFile)
+		}
+
+		if err := s.reload(); err != nil {
+			log.Errorf("failed to reload configuration, keeping the current configuration: %s", err)
+		}
+	}
+}
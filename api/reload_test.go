@@ -0,0 +1,299 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/ltm"
+)
+
+func TestSetHosts(t *testing.T) {
+	created := map[string]int{}
+	s := &server{
+		hosts: newHostMonitor(map[string]string{}),
+		newLTM: func(a common.Account) ltm.LTMIface {
+			created[a.LTMHost]++
+			return newMockLTM(t)
+		},
+	}
+
+	added, changed, removed := s.setHosts(map[string]common.Account{
+		"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "one"},
+		"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "two"},
+	}, nil, "aaa")
+
+	if len(added) != 2 || len(changed) != 0 || len(removed) != 0 {
+		t.Errorf("expected 2 added hosts, got %v, %v, %v", added, changed, removed)
+	}
+
+	ltm1, _ := s.ltmService("ltm1")
+	ltm2, _ := s.ltmService("ltm2")
+
+	// rotate the ltm2 password, remove ltm1 and add ltm3
+	added, changed, removed = s.setHosts(map[string]common.Account{
+		"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "rotated"},
+		"ltm3": {LTMHost: "ltm3.example.org", Username: "api", Password: "three"},
+	}, nil, "bbb")
+
+	if len(added) != 1 || added[0] != "ltm3" || len(changed) != 1 || changed[0] != "ltm2" || len(removed) != 1 || removed[0] != "ltm1" {
+		t.Errorf("unexpected changes added %v, changed %v, removed %v", added, changed, removed)
+	}
+
+	if _, ok := s.ltmService("ltm1"); ok {
+		t.Error("expected ltm1 to be removed")
+	}
+
+	if service, _ := s.ltmService("ltm2"); service == ltm2 {
+		t.Error("expected a new session for ltm2")
+	}
+
+	// the removed session still works for requests that already have it
+	if _, err := ltm1.ListClientSSLProfiles(); err != nil {
+		t.Errorf("expected the removed session to keep working, got %s", err)
+	}
+
+	// unchanged accounts keep their session
+	ltm3, _ := s.ltmService("ltm3")
+	s.setHosts(map[string]common.Account{
+		"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "rotated"},
+		"ltm3": {LTMHost: "ltm3.example.org", Username: "api", Password: "three"},
+	}, nil, "ccc")
+
+	if service, _ := s.ltmService("ltm3"); service != ltm3 {
+		t.Error("expected the ltm3 session to be kept")
+	}
+
+	expected := map[string]int{"ltm1.example.org": 1, "ltm2.example.org": 2, "ltm3.example.org": 1}
+	for host, n := range expected {
+		if created[host] != n {
+			t.Errorf("expected %d sessions created for %s, got %d", n, host, created[host])
+		}
+	}
+
+	if revision, _ := s.configVersion(); revision != "ccc" {
+		t.Errorf("expected config version ccc, got %s", revision)
+	}
+
+	if len(s.hosts.addresses) != 2 || s.hosts.addresses["ltm3"] != "ltm3.example.org" {
+		t.Errorf("expected the host monitor addresses to be updated, got %v", s.hosts.addresses)
+	}
+}
+
+func TestSetHostGroups(t *testing.T) {
+	s := &server{
+		hosts: newHostMonitor(map[string]string{}),
+		newLTM: func(a common.Account) ltm.LTMIface {
+			return newMockLTM(t)
+		},
+	}
+
+	accounts := map[string]common.Account{
+		"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "one"},
+		"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "two"},
+	}
+	groups := map[string]common.HostGroup{
+		"pair":   {Members: []string{"ltm2", "ltm1"}, SyncGroup: "sync-failover"},
+		"broken": {Members: []string{"ltm1", "ltm3"}},
+	}
+	s.setHosts(accounts, groups, "aaa")
+
+	service, ok := s.ltmService("pair")
+	if !ok {
+		t.Fatal("expected the pair host group")
+	}
+
+	group, ok := service.(*ltm.Group)
+	if !ok || group.SyncGroup != "sync-failover" || !reflect.DeepEqual(group.Members(), []string{"ltm2", "ltm1"}) {
+		t.Errorf("unexpected host group %+v", service)
+	}
+
+	if service, _ := s.ltmService("broken"); !reflect.DeepEqual(service.(*ltm.Group).Members(), []string{"ltm1"}) {
+		t.Errorf("expected unknown members to be skipped, got %v", service.(*ltm.Group).Members())
+	}
+
+	// groups aren't probed as hosts
+	if services := s.ltmServices(); len(services) != 2 {
+		t.Errorf("expected 2 hosts, got %d", len(services))
+	}
+
+	if _, ok := s.ltmService("missing"); ok {
+		t.Error("expected an unknown host not to be found")
+	}
+
+	// unchanged groups are kept, groups with a changed member are created with the new session
+	broken, _ := s.ltmService("broken")
+	accounts = map[string]common.Account{
+		"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "one"},
+		"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "rotated"},
+	}
+	s.setHosts(accounts, groups, "bbb")
+
+	if service, _ := s.ltmService("broken"); service != broken {
+		t.Error("expected the unchanged host group to be kept")
+	}
+
+	ltm2, _ := s.ltmService("ltm2")
+	if service, _ := s.ltmService("pair"); service == group || service.(*ltm.Group).MemberServices()[0].Service != ltm2 {
+		t.Error("expected the host group with a changed member to use the new session")
+	}
+
+	// a missing member that's added recreates the group
+	accounts["ltm3"] = common.Account{LTMHost: "ltm3.example.org", Username: "api", Password: "three"}
+	s.setHosts(accounts, groups, "ccc")
+
+	if service, _ := s.ltmService("broken"); service == broken || !reflect.DeepEqual(service.(*ltm.Group).Members(), []string{"ltm1", "ltm3"}) {
+		t.Errorf("expected the host group to be created with the new member, got %v", service.(*ltm.Group).Members())
+	}
+
+	s.setHosts(accounts, nil, "ddd")
+	if _, ok := s.ltmService("pair"); ok {
+		t.Error("expected the host group to be removed")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(accounts map[string]common.Account, mtime time.Time) {
+		data, err := json.Marshal(common.Config{Org: "test", Token: "sekret", Accounts: accounts})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, path, data)
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	start := time.Now().Add(-time.Minute)
+	writeConfig(map[string]common.Account{"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "one"}}, start)
+
+	load := func() (common.Config, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return common.Config{}, err
+		}
+		defer f.Close()
+		return common.ReadConfig(f)
+	}
+
+	config, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &server{
+		version: &apiVersion{Version: "0.1.0"},
+		hosts:   newHostMonitor(map[string]string{}),
+		newLTM: func(a common.Account) ltm.LTMIface {
+			return newMockLTM(t)
+		},
+	}
+	WithConfigReload(load, path, 10*time.Millisecond)(s)
+	s.setHosts(config.Accounts, config.HostGroups, config.Revision)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchConfig(ctx)
+
+	// a broken configuration is ignored
+	writeFile(t, path, []byte("{"))
+	os.Chtimes(path, start.Add(time.Second), start.Add(time.Second))
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := s.ltmService("ltm1"); !ok {
+		t.Fatal("expected the current configuration to be kept")
+	}
+
+	// an invalid configuration is ignored
+	writeConfig(map[string]common.Account{"ltm2": {LTMHost: "ltm2.example.org"}}, start.Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ok := s.ltmService("ltm2"); ok {
+		t.Fatal("expected an invalid configuration to be ignored")
+	}
+
+	writeConfig(map[string]common.Account{"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "two"}}, start.Add(3*time.Second))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := s.ltmService("ltm2"); ok {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the configuration to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, ok := s.ltmService("ltm1"); ok {
+		t.Error("expected ltm1 to be removed")
+	}
+
+	rr := httptest.NewRecorder()
+	s.VersionHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/f5/version", nil))
+
+	out := struct {
+		ConfigVersion string `json:"configVersion"`
+	}{}
+	if err := json.NewDecoder(rr.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if revision, _ := s.configVersion(); out.ConfigVersion == "" || out.ConfigVersion == config.Revision || out.ConfigVersion != revision {
+		t.Errorf("expected the reloaded config version, got %q", out.ConfigVersion)
+	}
+}
+
+func TestReloadRevision(t *testing.T) {
+	load := func() (common.Config, error) {
+		return common.Config{
+			Org:   "localdev",
+			Token: "token",
+			Accounts: map[string]common.Account{
+				"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "env:F5API_TEST_LTM1_PASSWORD", UploadPath: "/var/config/rest/downloads"},
+			},
+			Revision: "unchanged",
+		}, nil
+	}
+
+	s := &server{
+		context: context.Background(),
+		hosts:   newHostMonitor(map[string]string{}),
+		secrets: &secretResolver{},
+		newLTM: func(a common.Account) ltm.LTMIface {
+			return newMockLTM(t)
+		},
+	}
+	WithConfigReload(load, "", 0)(s)
+
+	t.Setenv("F5API_TEST_LTM1_PASSWORD", "one")
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.configVersion()
+
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if revision, _ := s.configVersion(); revision != first {
+		t.Errorf("expected the revision of the same configuration to be %s, got %s", first, revision)
+	}
+
+	// a rotated secret changes the revision, even though the configuration data is the same
+	t.Setenv("F5API_TEST_LTM1_PASSWORD", "two")
+	if err := s.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if revision, _ := s.configVersion(); revision == first || revision == "unchanged" {
+		t.Errorf("expected a new revision after the secret was rotated, got %s", revision)
+	}
+}
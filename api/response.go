@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// requestIDHeader carries the request id, it's accepted from the client or generated
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// Response is the envelope for all successful API responses
+type Response struct {
+	RequestID  string      `json:"requestId,omitempty"`
+	Operation  string      `json:"operation"`
+	Host       string      `json:"host,omitempty"`
+	Object     string      `json:"object,omitempty"`
+	DryRun     bool        `json:"dryRun,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Sync       *SyncResult `json:"sync,omitempty"`
+}
+
+// ErrorResponse is the envelope for all API errors
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an API error and its wrapped cause
+type ErrorDetail struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// RequestIDMiddleware sets the request id from the X-Request-Id header, or generates a new one,
+// and sets it on the request context and the response headers
+func RequestIDMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the request id from the context
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// newResponse builds a response envelope from the output of an operation, strings are returned
+// as the message and anything else as the data
+func newResponse(operation, host, object string, out interface{}) *Response {
+	resp := &Response{
+		Operation: operation,
+		Host:      host,
+		Object:    object,
+	}
+
+	if msg, ok := out.(string); ok {
+		resp.Message = msg
+	} else {
+		resp.Data = out
+	}
+
+	return resp
+}
+
+// writeResponse writes the response envelope as JSON with the given status
+func writeResponse(w http.ResponseWriter, status int, resp *Response) {
+	if resp.RequestID == "" {
+		resp.RequestID = w.Header().Get(requestIDHeader)
+	}
+
+	j, err := json.Marshal(resp)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", "failed to marshal json", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(j)
+}
+
+// writeError writes the error envelope as JSON with the given status
+func writeError(w http.ResponseWriter, status int, code, message string, cause error) {
+	e := ErrorDetail{
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get(requestIDHeader),
+	}
+
+	if cause != nil {
+		e.Detail = cause.Error()
+	}
+
+	j, err := json.Marshal(ErrorResponse{Error: e})
+	if err != nil {
+		log.Errorf("failed to marshal error response: %s", err)
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(j)
+}
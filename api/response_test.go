@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+)
+
+func TestHandleError(t *testing.T) {
+	type test struct {
+		err     error
+		status  int
+		code    string
+		message string
+		detail  string
+	}
+
+	tests := []test{
+		{
+			err:     apierror.New(apierror.ErrNotFound, "foo not found", nil),
+			status:  http.StatusNotFound,
+			code:    apierror.ErrNotFound,
+			message: "foo not found",
+		},
+		{
+			err:     apierror.New(apierror.ErrBadRequest, "bad foo", errors.New("boom")),
+			status:  http.StatusBadRequest,
+			code:    apierror.ErrBadRequest,
+			message: "bad foo",
+			detail:  "boom",
+		},
+		{
+			err:     apierror.New(apierror.ErrServiceUnavailable, "unavailable", nil),
+			status:  http.StatusServiceUnavailable,
+			code:    apierror.ErrServiceUnavailable,
+			message: "unavailable",
+		},
+		{
+			err:     errors.New("boom"),
+			status:  http.StatusInternalServerError,
+			code:    apierror.ErrInternalError,
+			message: "boom",
+		},
+	}
+
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		rr.Header().Set(requestIDHeader, "abc123")
+		handleError(rr, tc.err)
+
+		if rr.Code != tc.status {
+			t.Errorf("expected status %d, got %d", tc.status, rr.Code)
+		}
+
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected application/json content type, got %s", ct)
+		}
+
+		out := ErrorResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+			t.Fatalf("failed to unmarshal error response %s: %s", rr.Body.String(), err)
+		}
+
+		expected := ErrorDetail{Code: tc.code, Message: tc.message, RequestID: "abc123", Detail: tc.detail}
+		if out.Error != expected {
+			t.Errorf("expected error %+v, got %+v", expected, out.Error)
+		}
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var got string
+	h := RequestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestID(r.Context())
+		writeResponse(w, http.StatusOK, newResponse("test", "host", "object", "ok"))
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got == "" || rr.Header().Get(requestIDHeader) != got {
+		t.Errorf("expected generated request id %s in response header, got %s", got, rr.Header().Get(requestIDHeader))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "client-id")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if got != "client-id" {
+		t.Errorf("expected client request id, got %s", got)
+	}
+
+	out := Response{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := Response{RequestID: "client-id", Operation: "test", Host: "host", Object: "object", Message: "ok"}
+	if out != expected {
+		t.Errorf("expected response %+v, got %+v", expected, out)
+	}
+}
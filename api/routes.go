@@ -13,10 +13,29 @@ func (s *server) routes() {
 	api.HandleFunc("/ping", s.PingHandler).Methods(http.MethodGet)
 	api.HandleFunc("/version", s.VersionHandler).Methods(http.MethodGet)
 	api.Handle("/metrics", promhttp.Handler()).Methods(http.MethodGet)
+	api.HandleFunc("/ready", s.ReadyHandler).Methods(http.MethodGet)
+	api.HandleFunc("/health", s.HealthHandler).Methods(http.MethodGet)
+
+	api.HandleFunc("/hosts", s.ListHosts).Methods(http.MethodGet)
+	api.HandleFunc("/audit", s.ListAuditEvents).Methods(http.MethodGet)
+
+	api.HandleFunc("/jobs", s.ListJobs).Methods(http.MethodGet)
+	api.HandleFunc("/jobs/{id}", s.ShowJob).Methods(http.MethodGet)
+	api.HandleFunc("/jobs/{id}/events", s.JobEvents).Methods(http.MethodGet)
 
 	api.HandleFunc("/{host}/clientssl", s.ListClientSSLProfiles).Methods(http.MethodGet)
 	api.HandleFunc("/{host}/clientssl/{name}", s.ShowClientSSLProfile).Methods(http.MethodGet)
 	api.HandleFunc("/{host}/clientssl/{name}", s.DeleteClientSSLProfile).Methods(http.MethodDelete)
 	api.HandleFunc("/{host}/createclientssl/{name}", s.CreateClientSSLProfile).Methods(http.MethodPut)
 	api.HandleFunc("/{host}/updateclientssl/{name}", s.ModifyClientSSLProfile).Methods(http.MethodPut)
+	api.HandleFunc("/{host}/sync", s.SyncHost).Methods(http.MethodPost)
+
+	// ltm subrouter - /v2/f5
+	v2 := s.router.PathPrefix("/v2/f5").Subrouter()
+	v2.HandleFunc("/{host}/clientssl", s.ListClientSSLProfiles).Methods(http.MethodGet)
+	v2.HandleFunc("/{host}/clientssl", s.CreateClientSSLProfileV2).Methods(http.MethodPost)
+	v2.HandleFunc("/{host}/clientssl/{name}", s.ShowClientSSLProfile).Methods(http.MethodGet)
+	v2.HandleFunc("/{host}/clientssl/{name}", s.ReplaceClientSSLProfile).Methods(http.MethodPut)
+	v2.HandleFunc("/{host}/clientssl/{name}", s.PatchClientSSLProfile).Methods(http.MethodPatch)
+	v2.HandleFunc("/{host}/clientssl/{name}", s.DeleteClientSSLProfileV2).Methods(http.MethodDelete)
 }
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/ltm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// saveModeRequest saves the ltm configuration after each request that changes it
+	saveModeRequest = "request"
+	// saveModeDebounce saves the ltm configuration once it hasn't changed for the save delay
+	saveModeDebounce = "debounce"
+	// defaultSaveDelay is how long to wait for more changes before saving in debounce mode
+	defaultSaveDelay = 30 * time.Second
+)
+
+// SaveStatus is the status of saving the running configuration of an ltm
+type SaveStatus struct {
+	// Pending is set when there are changes waiting to be saved
+	Pending   bool       `json:"pending"`
+	LastSaved *time.Time `json:"lastSaved,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+// configSaver saves the running configuration of the ltms after changes, either right away or
+// once the changes to a host stop for the delay
+type configSaver struct {
+	mode  string
+	delay time.Duration
+	// lookup returns the current service for the host when a delayed save runs, since the host
+	// may have been changed or removed by a reload
+	lookup func(host string) (ltm.LTMIface, bool)
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	status map[string]*SaveStatus
+}
+
+// newConfigSaver creates the config saver from the save configuration, it returns nil if saving is disabled
+func newConfigSaver(config common.SaveConfig) (*configSaver, error) {
+	switch config.Mode {
+	case "":
+		return nil, nil
+	case saveModeRequest, saveModeDebounce:
+	default:
+		return nil, fmt.Errorf("invalid save mode %q", config.Mode)
+	}
+
+	delay := defaultSaveDelay
+	if config.Delay != "" {
+		d, err := time.ParseDuration(config.Delay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid save delay %q: %s", config.Delay, err)
+		}
+		delay = d
+	}
+
+	log.Infof("saving the ltm configuration after changes, mode: %s, delay: %s", config.Mode, delay)
+
+	return &configSaver{
+		mode:   config.Mode,
+		delay:  delay,
+		timers: map[string]*time.Timer{},
+		status: map[string]*SaveStatus{},
+	}, nil
+}
+
+// saveNames returns the hosts the save status is recorded for, the members for a host group
+func saveNames(host string, service ltm.LTMIface) []string {
+	if group, ok := service.(*ltm.Group); ok {
+		return group.Members()
+	}
+	return []string{host}
+}
+
+// save saves the configuration of the host and records the outcome.  timer is the scheduled save
+// that's running, if any.  The host stays pending if another save was scheduled while it was saving.
+func (c *configSaver) save(host string, service ltm.LTMIface, timer *time.Timer) error {
+	err := service.SaveConfig()
+	if err != nil {
+		log.Errorf("failed to save the configuration of %s: %s", host, err)
+	}
+
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	scheduled := c.done(host, timer)
+	for _, name := range saveNames(host, service) {
+		status := c.statusFor(name)
+		status.Pending = scheduled
+		if err != nil {
+			status.LastError = err.Error()
+			continue
+		}
+		status.LastSaved = &now
+		status.LastError = ""
+	}
+
+	return err
+}
+
+// schedule saves the configuration of the host after the delay, a change before then restarts the
+// delay.  The save uses the service for the host at that time, and is skipped if the host was removed.
+func (c *configSaver) schedule(host string, service ltm.LTMIface) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := saveNames(host, service)
+	for _, name := range names {
+		c.statusFor(name).Pending = true
+	}
+
+	if t, ok := c.timers[host]; ok {
+		t.Stop()
+	}
+
+	log.Debugf("saving the configuration of %s in %s", host, c.delay)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(c.delay, func() {
+		// the timer is set with the lock held, so it's read with the lock too
+		c.mu.Lock()
+		self := timer
+		c.mu.Unlock()
+
+		current, ok := service, true
+		if c.lookup != nil {
+			current, ok = c.lookup(host)
+		}
+
+		if !ok {
+			log.Warnf("%s was removed before its configuration was saved, skipping the save", host)
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			scheduled := c.done(host, self)
+			for _, name := range names {
+				c.statusFor(name).Pending = scheduled
+			}
+			return
+		}
+
+		c.save(host, current, self)
+	})
+	c.timers[host] = timer
+}
+
+// done removes the scheduled save of the host when it's finished and returns true if another save
+// is scheduled.  Stop doesn't stop a save that already started, so a save only removes itself and
+// not a newer one that replaced it.  It must be called with the lock held.
+func (c *configSaver) done(host string, timer *time.Timer) bool {
+	current, ok := c.timers[host]
+	if ok && current == timer {
+		delete(c.timers, host)
+		return false
+	}
+	return ok
+}
+
+// statusFor returns the save status of the host, it must be called with the lock held
+func (c *configSaver) statusFor(name string) *SaveStatus {
+	status, ok := c.status[name]
+	if !ok {
+		status = &SaveStatus{}
+		c.status[name] = status
+	}
+	return status
+}
+
+// hostStatus returns a copy of the save status of the host, or nil if it hasn't been changed
+func (c *configSaver) hostStatus(name string) *SaveStatus {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status, ok := c.status[name]
+	if !ok {
+		return nil
+	}
+
+	out := *status
+	return &out
+}
+
+// autoSave saves the configuration after the orchestrator changed the host, as a step of the
+// request in request mode or in the background in debounce mode.  A failed save doesn't fail the
+// request, since the changes were made, it's reported in the host status.
+func (o *ltmOrchestrator) autoSave(ctx context.Context) {
+	if o.saver == nil || (!o.changed && len(o.plan) == 0) {
+		return
+	}
+
+	host := o.event.Host
+
+	if o.saver.mode == saveModeDebounce {
+		if !o.dryRun {
+			o.saver.schedule(host, o.client)
+		}
+		return
+	}
+
+	o.apply(PlannedOperation{
+		Step:      "save config",
+		Operation: "SaveConfig",
+		Target:    host,
+	}, func() error {
+		return o.saver.save(host, o.client, nil)
+	})
+}
+
+// hostStatus returns the status of the ltm hosts with their save status
+func (s *server) hostStatus(ctx context.Context) ([]*HostStatus, time.Time) {
+	hosts, checkedAt := s.hosts.status(ctx, s.ltmServices())
+	if s.saver == nil {
+		return hosts, checkedAt
+	}
+
+	// the probe results are cached, so they're copied rather than changed
+	out := make([]*HostStatus, 0, len(hosts))
+	for _, h := range hosts {
+		status := *h
+		status.Save = s.saver.hostStatus(h.Name)
+		out = append(out, &status)
+	}
+
+	return out, checkedAt
+}
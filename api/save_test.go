@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
+	"github.com/gorilla/mux"
+)
+
+// newSaveTestServer creates a test server for the ltm host which saves the configuration
+func newSaveTestServer(t *testing.T, client ltm.LTMIface, config common.SaveConfig) *httptest.Server {
+	saver, err := newConfigSaver(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server{
+		router:      mux.NewRouter(),
+		context:     context.TODO(),
+		LTMServices: map[string]ltm.LTMIface{"ltm.example.org": client},
+		hosts:       newHostMonitor(map[string]string{"ltm.example.org": "ltm.example.org"}),
+		readyPolicy: &readinessPolicy{mode: readyPolicyAny},
+		saver:       saver,
+	}
+	if saver != nil {
+		saver.lookup = s.ltmService
+	}
+	s.routes()
+
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// hostSaveStatus gets the save status of the ltm host from the hosts endpoint
+func hostSaveStatus(t *testing.T, srv *httptest.Server) *SaveStatus {
+	resp := doRequest(t, http.MethodGet, srv.URL+"/v1/f5/hosts", nil)
+
+	out := struct {
+		Data []HostStatus `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out.Data) != 1 {
+		t.Fatalf("expected 1 host, got %+v", out.Data)
+	}
+
+	return out.Data[0].Save
+}
+
+func countWrites(m *mockLTM, call string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for _, w := range m.writes {
+		if w == call {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSaveConfigPerRequest(t *testing.T) {
+	profile := &bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2021.crt", Key: "www.example.org-2021.key"}
+	client := newMockLTM(t, profile)
+	srv := newSaveTestServer(t, client, common.SaveConfig{Mode: "request"})
+
+	if status := hostSaveStatus(t, srv); status != nil {
+		t.Errorf("expected no save status before changes, got %+v", status)
+	}
+
+	resp := doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org?dryRun=true", nil)
+	plan := struct {
+		Data []PlannedOperation `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(plan.Data); n == 0 || plan.Data[n-1].Operation != "SaveConfig" {
+		t.Errorf("expected the plan to end with a save, got %+v", plan.Data)
+	}
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if n := len(client.writes); n == 0 || client.writes[n-1] != "SaveConfig" {
+		t.Errorf("expected the configuration to be saved after the changes, got %v", client.writes)
+	}
+
+	if status := hostSaveStatus(t, srv); status == nil || status.Pending || status.LastSaved == nil || status.LastError != "" {
+		t.Errorf("expected a saved status, got %+v", status)
+	}
+
+	// reads don't save the configuration
+	doRequest(t, http.MethodGet, srv.URL+"/v1/f5/ltm.example.org/clientssl", nil)
+	if n := countWrites(client, "SaveConfig"); n != 1 {
+		t.Errorf("expected 1 save, got %d", n)
+	}
+
+	// a failed save is reported in the host status without failing the request
+	client = newMockLTM(t, profile)
+	client.failOn = "SaveConfig"
+	srv = newSaveTestServer(t, client, common.SaveConfig{Mode: "request"})
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if status := hostSaveStatus(t, srv); status == nil || status.LastSaved != nil || !strings.Contains(status.LastError, "boom") {
+		t.Errorf("expected a save error, got %+v", status)
+	}
+}
+
+func TestSaveConfigDebounce(t *testing.T) {
+	client := newMockLTM(t,
+		&bigip.ClientSSLProfile{Name: "one.example.org", Cert: "one.example.org-2021.crt", Key: "one.example.org-2021.key"},
+		&bigip.ClientSSLProfile{Name: "two.example.org", Cert: "two.example.org-2021.crt", Key: "two.example.org-2021.key"},
+	)
+	srv := newSaveTestServer(t, client, common.SaveConfig{Mode: "debounce", Delay: "100ms"})
+
+	doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/one.example.org", nil)
+	doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/two.example.org", nil)
+
+	if status := hostSaveStatus(t, srv); status == nil || !status.Pending {
+		t.Errorf("expected a pending save, got %+v", status)
+	}
+
+	if n := countWrites(client, "SaveConfig"); n != 0 {
+		t.Errorf("expected the save to be delayed, got %d saves", n)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countWrites(client, "SaveConfig") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the configuration to be saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// wait for any other saves to run
+	time.Sleep(200 * time.Millisecond)
+
+	if n := countWrites(client, "SaveConfig"); n != 1 {
+		t.Errorf("expected the changes to be saved once, got %d saves", n)
+	}
+
+	if status := hostSaveStatus(t, srv); status == nil || status.Pending || status.LastSaved == nil {
+		t.Errorf("expected a saved status, got %+v", status)
+	}
+}
+
+func TestSaveConfigDebounceReload(t *testing.T) {
+	saver, err := newConfigSaver(common.SaveConfig{Mode: "debounce", Delay: "50ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := newMockLTM(t)
+	current := newMockLTM(t)
+	s := &server{LTMServices: map[string]ltm.LTMIface{"ltm.example.org": current}}
+	saver.lookup = s.ltmService
+
+	// the save uses the session the host has when it runs
+	saver.schedule("ltm.example.org", old)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countWrites(current, "SaveConfig") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the configuration to be saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := countWrites(old, "SaveConfig"); n != 0 {
+		t.Errorf("expected the replaced session not to be saved, got %d saves", n)
+	}
+
+	// the save is skipped if the host was removed
+	saver.schedule("ltm.example.org", current)
+
+	s.mu.Lock()
+	s.LTMServices = map[string]ltm.LTMIface{}
+	s.mu.Unlock()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for status := saver.hostStatus("ltm.example.org"); status.Pending; status = saver.hostStatus("ltm.example.org") {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the save to be skipped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if n := countWrites(current, "SaveConfig"); n != 1 {
+		t.Errorf("expected the removed host not to be saved, got %d saves", n)
+	}
+}
+
+// blockingSaveLTM is an ltm that doesn't finish saving its configuration until released
+type blockingSaveLTM struct {
+	*mockLTM
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSaveLTM) SaveConfig() error {
+	b.saving <- struct{}{}
+	<-b.release
+	return b.mockLTM.SaveConfig()
+}
+
+func TestSaveConfigDebounceWhileSaving(t *testing.T) {
+	saver, err := newConfigSaver(common.SaveConfig{Mode: "debounce", Delay: "10ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &blockingSaveLTM{mockLTM: newMockLTM(t), saving: make(chan struct{}, 2), release: make(chan struct{}, 2)}
+
+	saver.schedule("ltm.example.org", client)
+	<-client.saving
+
+	// a change while the first save is running schedules another save, which isn't removed when
+	// the first save finishes
+	saver.schedule("ltm.example.org", client)
+	client.release <- struct{}{}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status := saver.hostStatus("ltm.example.org"); status.LastSaved == nil; status = saver.hostStatus("ltm.example.org") {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the first save")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status := saver.hostStatus("ltm.example.org"); !status.Pending {
+		t.Errorf("expected the change to still be pending after the first save, got %+v", status)
+	}
+
+	<-client.saving
+	client.release <- struct{}{}
+
+	deadline = time.Now().Add(5 * time.Second)
+	for countWrites(client.mockLTM, "SaveConfig") < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the configuration to be saved")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// another change is saved once
+	saver.schedule("ltm.example.org", client)
+	<-client.saving
+	client.release <- struct{}{}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if n := countWrites(client.mockLTM, "SaveConfig"); n != 3 {
+		t.Errorf("expected 3 saves, got %d", n)
+	}
+
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+
+	if len(saver.timers) != 0 || saver.status["ltm.example.org"].Pending {
+		t.Errorf("expected no pending saves, got %v, %+v", saver.timers, saver.status["ltm.example.org"])
+	}
+}
+
+func TestSaveConfigGroup(t *testing.T) {
+	group, standby, active := newTestGroup(t, true)
+
+	saver, err := newConfigSaver(common.SaveConfig{Mode: "request"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saver.save("pair", group, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if countWrites(standby, "SaveConfig") != 1 || countWrites(active, "SaveConfig") != 1 {
+		t.Errorf("expected both units to be saved, got %v and %v", standby.writes, active.writes)
+	}
+
+	for _, name := range []string{"ltm1", "ltm2"} {
+		if status := saver.hostStatus(name); status == nil || status.LastSaved == nil {
+			t.Errorf("expected a saved status for %s, got %+v", name, status)
+		}
+	}
+
+	if status := saver.hostStatus("pair"); status != nil {
+		t.Errorf("expected the status for the members, got %+v for the group", status)
+	}
+
+	if _, err := newConfigSaver(common.SaveConfig{Mode: "always"}); err == nil {
+		t.Error("expected error for an invalid mode")
+	}
+
+	if saver, err := newConfigSaver(common.SaveConfig{}); saver != nil || err != nil {
+		t.Errorf("expected saving to be disabled, got %v, %v", saver, err)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/YaleSpinup/f5-api/common"
+	"github.com/YaleSpinup/f5-api/session"
+	"github.com/YaleSpinup/f5-api/ssm"
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// secretEnvPrefix references an environment variable, ie. 'env:LTM1_PASSWORD'
+	secretEnvPrefix = "env:"
+	// secretFilePrefix references a file, ie. 'file:/run/secrets/ltm1-password'
+	secretFilePrefix = "file:"
+	// secretSSMPrefix references an SSM parameter, ie. 'ssm:/f5-api/ltm1/password'
+	secretSSMPrefix = "ssm:"
+)
+
+// parameterStore gets decrypted parameter values, it's satisfied by ssm.SSM
+type parameterStore interface {
+	GetParameter(ctx context.Context, name string) (string, error)
+}
+
+// secretResolver replaces secret references in the configuration with their values
+type secretResolver struct {
+	// params returns the parameter store for ssm references, it's only called when the
+	// configuration references an ssm parameter
+	params func(ctx context.Context) (parameterStore, error)
+	store  parameterStore
+}
+
+// resolve replaces the secret references in the account usernames and passwords and in the
+// API tokens.  Values without a reference prefix are used as-is.
+func (r *secretResolver) resolve(ctx context.Context, config *common.Config) error {
+	r.store = nil
+
+	names := make([]string, 0, len(config.Accounts))
+	for name := range config.Accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	accounts := make(map[string]common.Account, len(config.Accounts))
+	for _, name := range names {
+		a := config.Accounts[name]
+
+		var err error
+		if a.Username, err = r.value(ctx, a.Username); err != nil {
+			return fmt.Errorf("account %s username: %s", name, err)
+		}
+
+		if a.Password, err = r.value(ctx, a.Password); err != nil {
+			return fmt.Errorf("account %s password: %s", name, err)
+		}
+
+		accounts[name] = a
+	}
+	config.Accounts = accounts
+
+	token, err := r.value(ctx, config.Token)
+	if err != nil {
+		return fmt.Errorf("token: %s", err)
+	}
+	config.Token = token
+
+	tokens := make(map[string]common.TokenConfig, len(config.Tokens))
+	for name, t := range config.Tokens {
+		if t.Token, err = r.value(ctx, t.Token); err != nil {
+			return fmt.Errorf("token %s: %s", name, err)
+		}
+		tokens[name] = t
+	}
+	config.Tokens = tokens
+
+	return nil
+}
+
+// value returns the value of a secret reference, or the value itself if it isn't a reference
+func (r *secretResolver) value(ctx context.Context, v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, secretEnvPrefix):
+		name := strings.TrimPrefix(v, secretEnvPrefix)
+		out, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return out, nil
+	case strings.HasPrefix(v, secretFilePrefix):
+		path := strings.TrimPrefix(v, secretFilePrefix)
+		out, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %s", path, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	case strings.HasPrefix(v, secretSSMPrefix):
+		name := strings.TrimPrefix(v, secretSSMPrefix)
+		if r.store == nil {
+			if r.params == nil {
+				return "", fmt.Errorf("ssm parameter %s can't be resolved, ssm is not configured", name)
+			}
+
+			store, err := r.params(ctx)
+			if err != nil {
+				return "", fmt.Errorf("failed to create ssm client: %s", err)
+			}
+			r.store = store
+		}
+
+		out, err := r.store.GetParameter(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		return out, nil
+	}
+
+	return v, nil
+}
+
+// parameterStore creates the SSM client used to resolve secret references.  If a role is
+// configured, it's assumed with the org policy, otherwise the server's credentials are used.  The
+// session is created again if the region changed when the configuration was reloaded.
+func (s *server) parameterStore(config common.SecretsConfig) func(ctx context.Context) (parameterStore, error) {
+	return func(ctx context.Context) (parameterStore, error) {
+		region := config.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		if s.session.Session == nil || aws.StringValue(s.session.Session.Config.Region) != region {
+			s.session = session.New(session.WithRegion(region))
+		}
+
+		sess := s.session
+		if config.RoleArn != "" {
+			log.Debugf("assuming role %s to resolve ssm parameters", config.RoleArn)
+
+			assumed, err := s.assumeRole(ctx, config.ExternalID, config.RoleArn, s.orgPolicy)
+			if err != nil {
+				return nil, err
+			}
+			sess = *assumed
+		}
+
+		service := ssm.New(ssm.WithSession(sess.Session))
+		return &service, nil
+	}
+}
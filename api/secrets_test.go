@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/common"
+)
+
+// fakeParameterStore is a fake ssm parameter store
+type fakeParameterStore struct {
+	params map[string]string
+	calls  int
+}
+
+func (f *fakeParameterStore) GetParameter(ctx context.Context, name string) (string, error) {
+	f.calls++
+	v, ok := f.params[name]
+	if !ok {
+		return "", apierror.New(apierror.ErrNotFound, "ssm parameter "+name+" not found", nil)
+	}
+	return v, nil
+}
+
+func TestResolveSecrets(t *testing.T) {
+	t.Setenv("F5_TEST_LTM1_PASSWORD", "from-env")
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	writeFile(t, passwordFile, []byte("from-file\n"))
+
+	store := &fakeParameterStore{params: map[string]string{
+		"/f5-api/ltm3/password": "from-ssm",
+		"/f5-api/token":         "token-from-ssm",
+	}}
+
+	created := 0
+	r := &secretResolver{params: func(ctx context.Context) (parameterStore, error) {
+		created++
+		return store, nil
+	}}
+
+	config := common.Config{
+		Token: "ssm:/f5-api/token",
+		Tokens: map[string]common.TokenConfig{
+			"portal": {Token: "plain-token"},
+		},
+		Accounts: map[string]common.Account{
+			"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "env:F5_TEST_LTM1_PASSWORD"},
+			"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "file:" + passwordFile},
+			"ltm3": {LTMHost: "ltm3.example.org", Username: "api", Password: "ssm:/f5-api/ltm3/password"},
+			"ltm4": {LTMHost: "ltm4.example.org", Username: "api", Password: "plaintext"},
+		},
+	}
+	original := config.Accounts
+
+	if err := r.resolve(context.TODO(), &config); err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	expected := map[string]string{"ltm1": "from-env", "ltm2": "from-file", "ltm3": "from-ssm", "ltm4": "plaintext"}
+	for name, password := range expected {
+		if config.Accounts[name].Password != password {
+			t.Errorf("expected %s password %q, got %q", name, password, config.Accounts[name].Password)
+		}
+	}
+
+	if config.Token != "token-from-ssm" || config.Tokens["portal"].Token != "plain-token" {
+		t.Errorf("unexpected tokens %q, %+v", config.Token, config.Tokens)
+	}
+
+	if original["ltm1"].Password != "env:F5_TEST_LTM1_PASSWORD" {
+		t.Error("expected the original accounts to be unchanged")
+	}
+
+	if created != 1 || store.calls != 2 {
+		t.Errorf("expected one ssm client for 2 parameters, got %d clients and %d calls", created, store.calls)
+	}
+
+	bad := []string{
+		"env:F5_TEST_NOT_SET",
+		"file:" + filepath.Join(t.TempDir(), "missing"),
+		"ssm:/f5-api/missing",
+	}
+
+	for _, ref := range bad {
+		config := common.Config{Accounts: map[string]common.Account{"ltm1": {Password: ref}}}
+		if err := r.resolve(context.TODO(), &config); err == nil {
+			t.Errorf("expected error resolving %s", ref)
+		}
+	}
+
+	// ssm references fail without a parameter store
+	r = &secretResolver{params: func(ctx context.Context) (parameterStore, error) {
+		return nil, errors.New("no credentials")
+	}}
+
+	config = common.Config{Accounts: map[string]common.Account{"ltm1": {Password: "ssm:/f5-api/ltm3/password"}}}
+	if err := r.resolve(context.TODO(), &config); err == nil {
+		t.Error("expected error without a parameter store")
+	}
+
+	// plain values don't need ssm
+	config = common.Config{Accounts: map[string]common.Account{"ltm1": {Password: "plaintext"}}}
+	if err := r.resolve(context.TODO(), &config); err != nil {
+		t.Errorf("expected nil error for plain values, got %s", err)
+	}
+}
+
+func TestParameterStoreRegion(t *testing.T) {
+	s := &server{}
+
+	if _, err := s.parameterStore(common.SecretsConfig{})(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if region := *s.session.Session.Config.Region; region != "us-east-1" {
+		t.Errorf("expected the default region, got %s", region)
+	}
+
+	// a region changed by a reload creates a new session
+	if _, err := s.parameterStore(common.SecretsConfig{Region: "us-west-2"})(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	if region := *s.session.Session.Config.Region; region != "us-west-2" {
+		t.Errorf("expected the reloaded region, got %s", region)
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/YaleSpinup/f5-api/audit"
 	"github.com/YaleSpinup/f5-api/common"
 	"github.com/YaleSpinup/f5-api/iam"
+	"github.com/YaleSpinup/f5-api/job"
 	"github.com/YaleSpinup/f5-api/ltm"
 	"github.com/YaleSpinup/f5-api/session"
 	"github.com/gorilla/handlers"
@@ -19,6 +24,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// writeTimeout is the longest a request can take to write its response
+const writeTimeout = 15 * time.Second
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -34,17 +42,33 @@ type apiVersion struct {
 }
 
 type server struct {
-	router      *mux.Router
-	version     *apiVersion
-	context     context.Context
-	session     session.Session
-	orgPolicy   string
-	org         string
-	LTMServices map[string]ltm.LTMIface
+	router         *mux.Router
+	version        *apiVersion
+	context        context.Context
+	session        session.Session
+	orgPolicy      string
+	org            string
+	mu             sync.RWMutex
+	LTMServices    map[string]ltm.LTMIface
+	groups         map[string]*ltm.Group
+	groupConfigs   map[string]common.HostGroup
+	accounts       map[string]common.Account
+	newLTM         func(common.Account) ltm.LTMIface
+	configRevision string
+	configLoadedAt time.Time
+	loadConfig     ConfigLoader
+	configFile     string
+	reloadInterval time.Duration
+	jobs           *job.Manager
+	hosts          *hostMonitor
+	readyPolicy    *readinessPolicy
+	audit          *audit.Logger
+	saver          *configSaver
+	secrets        *secretResolver
 }
 
 // NewServer creates a new server and starts it
-func NewServer(config common.Config) error {
+func NewServer(config common.Config, opts ...ServerOption) error {
 	// setup server context with cancellation
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -59,6 +83,10 @@ func NewServer(config common.Config) error {
 		LTMServices: make(map[string]ltm.LTMIface),
 	}
 
+	for _, opt := range opts {
+		opt(&s)
+	}
+
 	s.version = &apiVersion{
 		Version:    config.Version.Version,
 		GitHash:    config.Version.GitHash,
@@ -70,16 +98,102 @@ func NewServer(config common.Config) error {
 		return err
 	}
 	s.orgPolicy = orgPolicy
+	s.org = config.Org
+
+	// Replace secret references in the configuration with their values
+	s.secrets = &secretResolver{params: s.parameterStore(config.Secrets)}
+	if err := s.secrets.resolve(ctx, &config); err != nil {
+		return fmt.Errorf("failed to resolve secrets: %s", err)
+	}
+
+	if err := config.SetRevision(); err != nil {
+		return err
+	}
 
 	// Create shared F5 BigIP sessions
-	for name, c := range config.Accounts {
-		s.LTMServices[name] = ltm.NewSession(c.LTMHost, c.Username, c.Password, c.UploadPath)
+	s.hosts = newHostMonitor(map[string]string{})
+	s.hosts.context = ctx
+	s.setHosts(config.Accounts, config.HostGroups, config.Revision)
+	go s.watchConfig(ctx)
+
+	if config.Health.Timeout != "" {
+		if s.hosts.timeout, err = time.ParseDuration(config.Health.Timeout); err != nil {
+			return fmt.Errorf("invalid health timeout %q: %s", config.Health.Timeout, err)
+		}
+	}
+
+	if config.Health.CacheTTL != "" {
+		if s.hosts.cacheTTL, err = time.ParseDuration(config.Health.CacheTTL); err != nil {
+			return fmt.Errorf("invalid health cache ttl %q: %s", config.Health.CacheTTL, err)
+		}
+	}
+
+	readyPolicy, err := newReadinessPolicy(config.Health)
+	if err != nil {
+		return err
+	}
+	s.readyPolicy = readyPolicy
+
+	jobs, err := newJobManager(config.Jobs)
+	if err != nil {
+		return err
+	}
+	s.jobs = jobs
+
+	if s.saver, err = newConfigSaver(config.Save); err != nil {
+		return err
+	}
+	if s.saver != nil {
+		s.saver.lookup = s.ltmService
+	}
+
+	auditLog, err := newAuditLogger(config.Audit)
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+	s.audit = auditLog
+
+	idempotencyWindow := 24 * time.Hour
+	if config.Idempotency.Window != "" {
+		idempotencyWindow, err = time.ParseDuration(config.Idempotency.Window)
+		if err != nil {
+			return fmt.Errorf("invalid idempotency window %q: %s", config.Idempotency.Window, err)
+		}
+	}
+	s.router.Use(ScopeMiddleware, newIdempotencyStore(idempotencyWindow).Middleware)
+
+	tokens, err := newAPITokens(config)
+	if err != nil {
+		return err
+	}
+	auth := &authenticator{tokens: tokens}
+
+	if auth.cache, auth.limiter, err = newAuthLimits(config.Auth); err != nil {
+		return err
+	}
+
+	if auth.clients, err = newClientCertAccess(config.TLS); err != nil {
+		return err
+	}
+
+	if config.OIDC != nil {
+		if auth.jwt, err = newJWTAuthenticator(ctx, config.OIDC); err != nil {
+			return err
+		}
 	}
 
 	publicURLs := map[string]string{
 		"/v1/f5/ping":    "public",
 		"/v1/f5/version": "public",
 		"/v1/f5/metrics": "public",
+		"/v1/f5/ready":   "public",
+		"/v1/f5/health":  "public",
+	}
+
+	cors, err := newCORSPolicy(config.CORS)
+	if err != nil {
+		return err
 	}
 
 	// load routes
@@ -88,14 +202,29 @@ func NewServer(config common.Config) error {
 	if config.ListenAddress == "" {
 		config.ListenAddress = ":8080"
 	}
-	handler := handlers.RecoveryHandler()(handlers.LoggingHandler(os.Stdout, TokenMiddleware([]byte(config.Token), publicURLs, s.router)))
+	handler := handlers.RecoveryHandler()(handlers.LoggingHandler(os.Stdout, RequestIDMiddleware(cors.Middleware(tokenMiddleware(auth, publicURLs, s.router)))))
 	srv := &http.Server{
 		Handler:      handler,
 		Addr:         config.ListenAddress,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: writeTimeout,
 		ReadTimeout:  15 * time.Second,
 	}
 
+	if config.TLS != nil {
+		tlsConfig, err := newTLSConfig(ctx, config.TLS)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+
+		log.Infof("Starting TLS listener on %s", config.ListenAddress)
+		if err := srv.ListenAndServeTLS("", ""); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
 	log.Infof("Starting listener on %s", config.ListenAddress)
 	if err := srv.ListenAndServe(); err != nil {
 		return err
@@ -104,6 +233,85 @@ func NewServer(config common.Config) error {
 	return nil
 }
 
+// newJobManager creates the asynchronous job manager from the jobs configuration
+func newJobManager(config common.JobsConfig) (*job.Manager, error) {
+	opts := []job.ManagerOption{}
+
+	if config.StorePath != "" {
+		opts = append(opts, job.WithStorePath(config.StorePath))
+	}
+
+	if config.Retention != "" {
+		retention, err := time.ParseDuration(config.Retention)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jobs retention %q: %s", config.Retention, err)
+		}
+		opts = append(opts, job.WithRetention(retention))
+	}
+
+	if config.MaxJobs > 0 {
+		opts = append(opts, job.WithMaxJobs(config.MaxJobs))
+	}
+
+	return job.New(opts...)
+}
+
+// newAuthLimits creates the verified token cache and the failed authentication limiter from the auth configuration
+func newAuthLimits(config common.AuthConfig) (*tokenCache, *failureLimiter, error) {
+	cacheTTL := 5 * time.Minute
+	if config.CacheTTL != "" {
+		d, err := time.ParseDuration(config.CacheTTL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid auth cache ttl %q: %s", config.CacheTTL, err)
+		}
+		cacheTTL = d
+	}
+
+	cacheSize := 1000
+	if config.CacheSize > 0 {
+		cacheSize = config.CacheSize
+	}
+
+	window := time.Minute
+	if config.FailureWindow != "" {
+		d, err := time.ParseDuration(config.FailureWindow)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid auth failure window %q: %s", config.FailureWindow, err)
+		}
+		window = d
+	}
+
+	limiter := newFailureLimiter(config.MaxFailures, window)
+	for _, cidr := range config.TrustedProxies {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid auth trusted proxy %q: %s", cidr, err)
+		}
+		limiter.trustedProxies = append(limiter.trustedProxies, network)
+	}
+
+	return newTokenCache(cacheTTL, cacheSize), limiter, nil
+}
+
+// newAuditLogger creates the audit log of LTM changes from the audit configuration
+func newAuditLogger(config common.AuditConfig) (*audit.Logger, error) {
+	opts := []audit.LoggerOption{}
+
+	if config.File != "" {
+		opts = append(opts, audit.WithFile(config.File))
+	}
+
+	if config.Stdout {
+		opts = append(opts, audit.WithStdout())
+	}
+
+	if config.MaxEvents > 0 {
+		opts = append(opts, audit.WithMaxEvents(config.MaxEvents))
+	}
+
+	return audit.New(opts...)
+}
+
 // LogWriter is an http.ResponseWriter
 type LogWriter struct {
 	http.ResponseWriter
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleSpinup/f5-api/ltm"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// syncRequestTimeout is the longest a request that isn't run as a job waits for a host group to
+// be in sync, so the response is written before the server's write timeout
+var syncRequestTimeout = writeTimeout - 5*time.Second
+
+// SyncResult is the outcome of syncing a host group's configuration to its sync group
+type SyncResult struct {
+	SyncGroup string `json:"syncGroup"`
+	Status    string `json:"status,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SyncHost syncs the configuration of a host group's active unit to its sync group and waits for
+// the group to be in sync
+func (s *server) SyncHost(w http.ResponseWriter, r *http.Request) {
+	w = LogWriter{w}
+	host := mux.Vars(r)["host"]
+
+	log.Infof("sync host group %s", host)
+
+	s.orchestrate(w, r, "sync", host, "sync", http.StatusOK,
+		func(ctx context.Context, orch *ltmOrchestrator) (interface{}, error) {
+			out, err := orch.syncConfig(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			if orch.dryRun {
+				return nil, nil
+			}
+			return out, nil
+		})
+}
+
+// syncConfig syncs the configuration of the orchestrator's host group to its sync group as an
+// orchestration step
+func (o *ltmOrchestrator) syncConfig(ctx context.Context) (*SyncResult, error) {
+	group, ok := o.client.(*ltm.Group)
+	if !ok || group.SyncGroup == "" {
+		msg := fmt.Sprintf("%s isn't a host group with a sync group", o.event.Host)
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	o.synced = true
+
+	timeout := group.SyncTimeout
+	if o.syncTimeout > 0 && o.syncTimeout < timeout {
+		timeout = o.syncTimeout
+	}
+
+	out := &SyncResult{SyncGroup: group.SyncGroup}
+	err := o.apply(PlannedOperation{
+		Step:      "sync config",
+		Operation: "SyncConfig",
+		Target:    group.SyncGroup,
+	}, func() error {
+		status, err := group.Sync(ctx, timeout)
+		if status != nil {
+			out.Status = status.Status
+			out.Summary = status.Summary
+		}
+		return err
+	})
+
+	return out, err
+}
+
+// autoSync syncs the host group after the orchestrator changed it, if the group has automatic
+// sync enabled.  It returns nil if the group wasn't synced.  A failed sync doesn't fail the
+// request, since the changes were made, so the error is returned in the result.
+func (o *ltmOrchestrator) autoSync(ctx context.Context) *SyncResult {
+	group, ok := o.client.(*ltm.Group)
+	if !ok || !group.AutoSync || o.synced || (!o.changed && len(o.plan) == 0) {
+		return nil
+	}
+
+	out, err := o.syncConfig(ctx)
+	if o.dryRun {
+		return nil
+	}
+
+	if err != nil {
+		log.Warnf("failed to sync host group %s after changes: %s", o.event.Host, err)
+		out.Error = err.Error()
+	}
+
+	return out
+}
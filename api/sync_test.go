@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/ltm"
+	bigip "github.com/YaleUniversity/go-bigip"
+)
+
+// newTestGroup returns a host group with a standby and an active unit, with the test profile on both
+func newTestGroup(t *testing.T, autoSync bool) (*ltm.Group, *mockLTM, *mockLTM) {
+	profile := &bigip.ClientSSLProfile{Name: "www.example.org", Cert: "www.example.org-2021.crt", Key: "www.example.org-2021.key"}
+
+	standby := newMockLTM(t, profile)
+	standby.failover = "STANDBY"
+	active := newMockLTM(t, profile)
+
+	group := ltm.NewGroup("pair", "sync-failover", []ltm.GroupMember{
+		{Name: "ltm1", Service: standby},
+		{Name: "ltm2", Service: active},
+	})
+	group.AutoSync = autoSync
+	group.SyncTimeout = 5 * time.Second
+
+	return group, standby, active
+}
+
+func TestAutoSync(t *testing.T) {
+	group, standby, active := newTestGroup(t, true)
+	srv := newTestServer(t, group)
+
+	// dry-run plans the sync without making any changes
+	resp := doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org?dryRun=true", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	plan := struct {
+		Data []PlannedOperation `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(plan.Data); n == 0 || plan.Data[n-1].Operation != "SyncConfig" || plan.Data[n-1].Target != "sync-failover" {
+		t.Errorf("expected the plan to end with a sync, got %+v", plan.Data)
+	}
+
+	if len(active.writes) != 0 || len(standby.writes) != 0 {
+		t.Fatalf("expected no writes in dry-run, got %v and %v", active.writes, standby.writes)
+	}
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	out := Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Sync == nil || out.Sync.SyncGroup != "sync-failover" || out.Sync.Status != ltm.SyncStatusInSync || out.Sync.Error != "" {
+		t.Errorf("expected the group to be synced, got %+v", out.Sync)
+	}
+
+	if len(standby.writes) != 0 {
+		t.Errorf("expected no writes on the standby unit, got %v", standby.writes)
+	}
+
+	if n := len(active.writes); n == 0 || active.writes[n-1] != "SyncConfig sync-failover" {
+		t.Errorf("expected the changes and sync on the active unit, got %v", active.writes)
+	}
+
+	// a failed sync is reported without failing the request
+	group, _, active = newTestGroup(t, true)
+	active.failOn = "SyncConfig"
+	srv = newTestServer(t, group)
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	out = Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Sync == nil || out.Sync.Error == "" {
+		t.Errorf("expected the sync error in the response, got %+v", out.Sync)
+	}
+
+	// a v2 delete returns the sync result instead of no content
+	group, _, _ = newTestGroup(t, true)
+	srv = newTestServer(t, group)
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v2/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	out = Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Sync == nil || out.Sync.Status != ltm.SyncStatusInSync {
+		t.Errorf("expected the sync result in the response, got %+v", out.Sync)
+	}
+
+	// groups without automatic sync aren't synced
+	group, _, active = newTestGroup(t, false)
+	srv = newTestServer(t, group)
+
+	resp = doRequest(t, http.MethodDelete, srv.URL+"/v1/f5/ltm.example.org/clientssl/www.example.org", nil)
+	out = Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Sync != nil || strings.Contains(strings.Join(active.writes, ","), "SyncConfig") {
+		t.Errorf("expected no sync, got %+v, %v", out.Sync, active.writes)
+	}
+}
+
+func TestAutoSyncRequestTimeout(t *testing.T) {
+	timeout := syncRequestTimeout
+	syncRequestTimeout = 1500 * time.Millisecond
+	t.Cleanup(func() { syncRequestTimeout = timeout })
+
+	// the group's sync timeout is longer than a request can wait
+	group, _, active := newTestGroup(t, true)
+	group.SyncTimeout = time.Minute
+	active.syncStatus = "Changes Pending"
+	srv := newTestServer(t, group)
+
+	start := time.Now()
+	resp := doRequest(t, http.MethodDelete, srv.URL+"/v2/f5/ltm.example.org/clientssl/www.example.org", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the sync wait to be limited, took %s", elapsed)
+	}
+
+	out := Response{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Sync == nil || out.Sync.Status != "Changes Pending" || !strings.Contains(out.Sync.Error, "1.5s") {
+		t.Errorf("expected the sync to time out after the request timeout, got %+v", out.Sync)
+	}
+}
+
+func TestSyncHost(t *testing.T) {
+	group, _, active := newTestGroup(t, false)
+	srv := newTestServer(t, group)
+
+	resp := doRequest(t, http.MethodPost, srv.URL+"/v1/f5/ltm.example.org/sync", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	out := struct {
+		Data SyncResult `json:"data"`
+		Sync *SyncResult
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Data.SyncGroup != "sync-failover" || out.Data.Status != ltm.SyncStatusInSync || out.Data.Summary != "sync summary" {
+		t.Errorf("unexpected sync result %+v", out.Data)
+	}
+
+	if out.Sync != nil {
+		t.Errorf("expected the group to be synced once, got %+v", out.Sync)
+	}
+
+	if len(active.writes) != 1 || active.writes[0] != "SyncConfig sync-failover" {
+		t.Errorf("expected one sync, got %v", active.writes)
+	}
+
+	// a sync that doesn't finish fails the request
+	group, _, active = newTestGroup(t, false)
+	group.SyncTimeout = 1500 * time.Millisecond
+	active.syncStatus = "Changes Pending"
+	srv = newTestServer(t, group)
+
+	resp = doRequest(t, http.MethodPost, srv.URL+"/v1/f5/ltm.example.org/sync", nil)
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	// single hosts can't be synced
+	srv = newTestServer(t, newMockLTM(t))
+
+	resp = doRequest(t, http.MethodPost, srv.URL+"/v1/f5/ltm.example.org/sync", nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected %d, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
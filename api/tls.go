@@ -0,0 +1,198 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// certReloadInterval is how often the serving certificate and key files are checked for changes
+const certReloadInterval = 30 * time.Second
+
+// certReloader serves a certificate and key from files, reloading them when they change
+type certReloader struct {
+	mu       sync.RWMutex
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// newCertReloader loads the certificate and key
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCertificate returns the current certificate, it's used as the tls.Config GetCertificate function
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// reload loads the certificate and key if either file has changed since they were last loaded
+// and returns true if they were reloaded.  The current certificate is kept if loading fails.
+func (c *certReloader) reload() (bool, error) {
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && modTime.Equal(c.modTime)
+	c.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load tls certificate and key: %s", err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mu.Unlock()
+
+	log.Infof("loaded tls certificate from %s", c.certFile)
+
+	return true, nil
+}
+
+// watch checks the certificate and key files for changes until the context is cancelled
+func (c *certReloader) watch(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.reload(); err != nil {
+				log.Errorf("failed to reload tls certificate, keeping the current certificate: %s", err)
+			}
+		}
+	}
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// newTLSConfig creates the listener TLS configuration.  The serving certificate is reloaded when
+// it changes until the context is cancelled.  If a client CA bundle is configured, client
+// certificates are verified against it.
+func newTLSConfig(ctx context.Context, config *common.TLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("tls certFile and keyFile are required")
+	}
+
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.watch(ctx, certReloadInterval)
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls client ca file: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls client ca file %s", config.ClientCAFile)
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if config.RequireClientCert {
+		return nil, fmt.Errorf("tls clientCAFile is required to require client certificates")
+	}
+
+	return tlsConfig, nil
+}
+
+// newClientCertAccess creates the map of client certificate subjects to the access they're granted
+func newClientCertAccess(config *common.TLSConfig) (map[string]Access, error) {
+	clients := make(map[string]Access)
+	if config == nil {
+		return clients, nil
+	}
+
+	subjects := make([]string, 0, len(config.Clients))
+	for subject := range config.Clients {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+
+	for _, subject := range subjects {
+		access, err := newAccess(config.Clients[subject])
+		if err != nil {
+			return nil, fmt.Errorf("tls client %s: %s", subject, err)
+		}
+		clients[subject] = access
+	}
+
+	return clients, nil
+}
+
+// clientCertIdentity returns the identity for a verified client certificate, matching the subject
+// by full distinguished name or common name
+func clientCertIdentity(state *tls.ConnectionState, clients map[string]Access) (*Identity, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	subject := state.VerifiedChains[0][0].Subject
+
+	if access, ok := clients[subject.String()]; ok {
+		return &Identity{Name: subject.String(), Access: []Access{access}}, true
+	}
+
+	if access, ok := clients[subject.CommonName]; ok && subject.CommonName != "" {
+		return &Identity{Name: subject.CommonName, Access: []Access{access}}, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/YaleSpinup/f5-api/common"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a PEM encoded certificate and key signed by the CA
+func (ca *testCA) issue(t *testing.T, cn string, serial int64, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kder, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	cert, key := ca.issue(t, "api.example.org", 2, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	first, _ := r.GetCertificate(nil)
+
+	if reloaded, err := r.reload(); err != nil || reloaded {
+		t.Errorf("expected no reload for unchanged files, got %t, %v", reloaded, err)
+	}
+
+	cert, key = ca.issue(t, "api.example.org", 3, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	if reloaded, err := r.reload(); err != nil || !reloaded {
+		t.Fatalf("expected reload for changed files, got %t, %v", reloaded, err)
+	}
+
+	second, _ := r.GetCertificate(nil)
+	if first == second {
+		t.Error("expected a new certificate after reload")
+	}
+
+	// a broken certificate keeps the current one
+	writeFile(t, certFile, []byte("garbage"))
+	later = later.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	if _, err := r.reload(); err == nil {
+		t.Error("expected error reloading a broken certificate")
+	}
+
+	if current, _ := r.GetCertificate(nil); current != second {
+		t.Error("expected the current certificate to be kept")
+	}
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	ca := newTestCA(t)
+	otherCA := newTestCA(t)
+	dir := t.TempDir()
+
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "api.example.org", 2, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, cert)
+	writeFile(t, keyFile, key)
+	writeFile(t, caFile, ca.pem)
+
+	config := &common.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		Clients: map[string]common.AccessConfig{
+			"portal.example.org": {Hosts: []string{"*"}, Objects: []string{"*"}, Scope: "rw"},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tlsConfig, err := newTLSConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	clients, err := newClientCertAccess(config)
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	var name string
+	srv := httptest.NewUnstartedServer(tokenMiddleware(&authenticator{clients: clients}, map[string]string{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name = identity(r.Context()).Name
+	})))
+	// httptest.StartTLS would add its own certificate, so serve TLS with the listener instead
+	srv.Listener = tls.NewListener(srv.Listener, tlsConfig)
+	srv.Start()
+	defer srv.Close()
+	url := "https://" + srv.Listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+
+	get := func(clientCert, clientKey []byte) int {
+		t.Helper()
+
+		c := &tls.Config{RootCAs: roots}
+		if clientCert != nil {
+			pair, err := tls.X509KeyPair(clientCert, clientKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Certificates = []tls.Certificate{pair}
+		}
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: c}}
+		resp, err := client.Get(url + "/private")
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if status := get(ca.issue(t, "portal.example.org", 4, x509.ExtKeyUsageClientAuth)); status != http.StatusOK || name != "portal.example.org" {
+		t.Errorf("expected %d for portal.example.org, got %d for %q", http.StatusOK, status, name)
+	}
+
+	if status := get(ca.issue(t, "unknown.example.org", 5, x509.ExtKeyUsageClientAuth)); status != http.StatusForbidden {
+		t.Errorf("expected %d for an unmapped subject, got %d", http.StatusForbidden, status)
+	}
+
+	if status := get(otherCA.issue(t, "portal.example.org", 6, x509.ExtKeyUsageClientAuth)); status == http.StatusOK {
+		t.Error("expected a certificate from another CA to be rejected")
+	}
+
+	if status := get(nil, nil); status != http.StatusForbidden {
+		t.Errorf("expected %d without a client certificate, got %d", http.StatusForbidden, status)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	bad := []*common.TLSConfig{
+		{CertFile: "tls.crt"},
+		{CertFile: "/does/not/exist.crt", KeyFile: "/does/not/exist.key"},
+	}
+
+	for _, c := range bad {
+		if _, err := newTLSConfig(context.TODO(), c); err == nil {
+			t.Errorf("expected error for config %+v", c)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenCache is a bounded cache of X-Auth-Token values that have been verified against the
+// configured tokens, so bcrypt only runs the first time a token hash is seen.  Entries are keyed
+// by the SHA-256 digest of the header, so the lookup time doesn't depend on how much of the
+// token matches, and they expire after the ttl.  The least recently used entry is evicted when
+// the cache is full.
+type tokenCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[[sha256.Size]byte]*list.Element
+	lru        *list.List
+}
+
+type tokenCacheEntry struct {
+	key      [sha256.Size]byte
+	identity *Identity
+	expires  time.Time
+}
+
+// newTokenCache creates a token cache, a zero ttl or size disables caching
+func newTokenCache(ttl time.Duration, maxEntries int) *tokenCache {
+	return &tokenCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[[sha256.Size]byte]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the identity for a verified token
+func (c *tokenCache) get(token []byte) (*Identity, bool) {
+	if c == nil || c.ttl <= 0 || c.maxEntries <= 0 {
+		return nil, false
+	}
+
+	key := sha256.Sum256(token)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*tokenCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	return entry.identity, true
+}
+
+// put caches the identity for a verified token, evicting the least recently used entry if the cache is full
+func (c *tokenCache) put(token []byte, identity *Identity) {
+	if c == nil || c.ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+
+	key := sha256.Sum256(token)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+
+	for c.lru.Len() >= c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[key] = c.lru.PushFront(&tokenCacheEntry{
+		key:      key,
+		identity: identity,
+		expires:  time.Now().Add(c.ttl),
+	})
+}
+
+// remove deletes the cache entry, it must be called with the lock held
+func (c *tokenCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*tokenCacheEntry).key)
+}
+
+// failureLimiter limits the number of failed authentication attempts from each client IP to
+// maxFailures in a window.  Once the limit is reached, failed attempts from the IP are rejected
+// until the window ends.
+type failureLimiter struct {
+	mu          sync.Mutex
+	maxFailures int
+	window      time.Duration
+	maxClients  int
+	clients     map[string]*failureWindow
+	// trustedProxies are the networks of the proxies whose X-Forwarded-For header has the client IP
+	trustedProxies []*net.IPNet
+}
+
+type failureWindow struct {
+	count int
+	start time.Time
+}
+
+// newFailureLimiter creates a failure limiter, zero or negative maxFailures disables limiting
+func newFailureLimiter(maxFailures int, window time.Duration) *failureLimiter {
+	return &failureLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		maxClients:  10000,
+		clients:     make(map[string]*failureWindow),
+	}
+}
+
+// clientIP returns the IP address of the client.  When the request comes from a trusted proxy,
+// it's the last address in the X-Forwarded-For header that isn't a trusted proxy, since the
+// addresses before it could have been set by the client.
+func (l *failureLimiter) clientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if l == nil || !l.trusted(ip) {
+		return ip
+	}
+
+	forwarded := []string{}
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(h, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			break
+		}
+
+		ip = addr
+		if !l.trusted(addr) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// trusted returns true if the address is a trusted proxy
+func (l *failureLimiter) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range l.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// blocked returns true and the time until the window ends if the client has reached the failure limit
+func (l *failureLimiter) blocked(ip string) (bool, time.Duration) {
+	if l == nil || l.maxFailures <= 0 {
+		return false, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.clients[ip]
+	if !ok {
+		return false, 0
+	}
+
+	remaining := time.Until(f.start.Add(l.window))
+	if remaining <= 0 {
+		delete(l.clients, ip)
+		return false, 0
+	}
+
+	return f.count >= l.maxFailures, remaining
+}
+
+// fail records a failed authentication attempt from the client
+func (l *failureLimiter) fail(ip string) {
+	if l == nil || l.maxFailures <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	f, ok := l.clients[ip]
+	if !ok || now.After(f.start.Add(l.window)) {
+		if len(l.clients) >= l.maxClients {
+			l.prune(now)
+		}
+
+		f = &failureWindow{start: now}
+		l.clients[ip] = f
+	}
+
+	f.count++
+}
+
+// prune removes the clients whose window has ended, it must be called with the lock held
+func (l *failureLimiter) prune(now time.Time) {
+	for ip, f := range l.clients {
+		if now.After(f.start.Add(l.window)) {
+			delete(l.clients, ip)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTokenCache(t *testing.T) {
+	c := newTokenCache(time.Minute, 2)
+	a, b, d := &Identity{Name: "a"}, &Identity{Name: "b"}, &Identity{Name: "d"}
+
+	c.put([]byte("hash-a"), a)
+	c.put([]byte("hash-b"), b)
+
+	if i, ok := c.get([]byte("hash-a")); !ok || i != a {
+		t.Errorf("expected cached identity a, got %v, %t", i, ok)
+	}
+
+	// b is the least recently used entry
+	c.put([]byte("hash-d"), d)
+
+	if _, ok := c.get([]byte("hash-b")); ok {
+		t.Error("expected b to be evicted")
+	}
+
+	for _, h := range []string{"hash-a", "hash-d"} {
+		if _, ok := c.get([]byte(h)); !ok {
+			t.Errorf("expected %s to be cached", h)
+		}
+	}
+
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d, %d", len(c.entries), c.lru.Len())
+	}
+
+	// expired entries are removed
+	c = newTokenCache(time.Millisecond, 2)
+	c.put([]byte("hash-a"), a)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.get([]byte("hash-a")); ok {
+		t.Error("expected expired entry to be missed")
+	}
+
+	if len(c.entries) != 0 {
+		t.Errorf("expected expired entry to be removed, got %d entries", len(c.entries))
+	}
+
+	// a zero ttl disables the cache
+	c = newTokenCache(0, 2)
+	c.put([]byte("hash-a"), a)
+	if _, ok := c.get([]byte("hash-a")); ok {
+		t.Error("expected disabled cache to miss")
+	}
+}
+
+func TestFailureLimiter(t *testing.T) {
+	l := newFailureLimiter(2, 50*time.Millisecond)
+
+	l.fail("192.0.2.1")
+	if blocked, _ := l.blocked("192.0.2.1"); blocked {
+		t.Error("expected client to be allowed after 1 failure")
+	}
+
+	l.fail("192.0.2.1")
+	blocked, retry := l.blocked("192.0.2.1")
+	if !blocked || retry <= 0 {
+		t.Errorf("expected client to be blocked after 2 failures, got %t, %s", blocked, retry)
+	}
+
+	if blocked, _ := l.blocked("192.0.2.2"); blocked {
+		t.Error("expected other clients to be allowed")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if blocked, _ := l.blocked("192.0.2.1"); blocked {
+		t.Error("expected client to be allowed after the window")
+	}
+
+	if blocked, _ := newFailureLimiter(-1, time.Minute).blocked("192.0.2.1"); blocked {
+		t.Error("expected disabled limiter to allow clients")
+	}
+}
+
+func TestTokenMiddlewareCacheAndLimit(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("portal-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &authenticator{
+		tokens: []apiToken{
+			{psk: []byte("portal-token"), identity: &Identity{Name: "portal", Access: []Access{fullAccess}}},
+		},
+		cache:   newTokenCache(time.Minute, 10),
+		limiter: newFailureLimiter(2, time.Minute),
+	}
+
+	h := tokenMiddleware(auth, map[string]string{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(token, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/f5/hosts", nil)
+		req.RemoteAddr = remote
+		req.Header.Set("X-Auth-Token", token)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := request(string(hash), "192.0.2.1:1234"); rr.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if _, ok := auth.cache.get(hash); !ok {
+		t.Error("expected the verified token to be cached")
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := request("wrong", "192.0.2.1:1234"); rr.Code != http.StatusForbidden {
+			t.Errorf("expected %d for a wrong token, got %d", http.StatusForbidden, rr.Code)
+		}
+	}
+
+	rr := request("wrong", "192.0.2.1:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected %d with Retry-After after too many failures, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// a cached token is accepted from a client over the limit, ie. another client behind the same proxy
+	if rr := request(string(hash), "192.0.2.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("expected %d for a cached token from a blocked client, got %d", http.StatusOK, rr.Code)
+	}
+
+	// a token that isn't cached isn't checked, so a blocked client can't tell if it's correct
+	other, err := bcrypt.GenerateFromPassword([]byte("portal-token"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr := request(string(other), "192.0.2.1:1234"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected %d for a valid token that isn't cached from a blocked client, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	if _, ok := auth.cache.get(other); ok {
+		t.Error("expected the token not to be verified for a blocked client")
+	}
+
+	if rr := request("wrong", "192.0.2.2:1234"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected %d from another client, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestFailureLimiterClientIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := newFailureLimiter(10, time.Minute)
+	l.trustedProxies = []*net.IPNet{proxies}
+
+	tests := []struct {
+		remote    string
+		forwarded []string
+		expected  string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		// the header is only used from a trusted proxy
+		{"192.0.2.1:1234", []string{"198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		// addresses added by the client before the proxies are ignored
+		{"10.0.0.1:1234", []string{"203.0.113.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"203.0.113.1", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.1:1234", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"10.0.0.1:1234", []string{"garbage"}, "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/v1/f5/hosts", nil)
+		req.RemoteAddr = test.remote
+		for _, f := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", f)
+		}
+
+		if ip := l.clientIP(req); ip != test.expected {
+			t.Errorf("expected client ip %s from %s with %v, got %s", test.expected, test.remote, test.forwarded, ip)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package api
 
+import (
+	"time"
+
+	bigip "github.com/YaleUniversity/go-bigip"
+)
+
 // ClientSSLProfile is an ltm clientSSL Profile
 type ClientSSLProfile struct {
 	Cert                 string `json:"cert"`
@@ -22,3 +28,37 @@ type ModifyClientSSLProfileRequest struct {
 	CipherGroup          string `json:"ciphergroup"`
 	ClientSSLProfile     *ClientSSLProfile
 }
+
+// PatchClientSSLProfileRequest is a partial update of a client ssl profile, fields which are
+// not supplied are left unchanged.  The cert and key are optional but must be supplied together.
+type PatchClientSSLProfileRequest struct {
+	CertificateFile      string   `json:"cert"`
+	KeyFile              string   `json:"key"`
+	ClientSSLProfileName string   `json:"clientssl-profile"`
+	Chain                *string  `json:"chain"`
+	DefaultsFrom         *string  `json:"defaultsfrom"`
+	Ciphers              *string  `json:"ciphers"`
+	CipherGroup          *string  `json:"ciphergroup"`
+	Renegotiation        *bool    `json:"renegotiation"`
+	SessionTicket        *bool    `json:"sessionticket"`
+	OCSPStapling         *bool    `json:"ocspstapling"`
+	TLSVersions          []string `json:"tlsversions"`
+}
+
+// PlannedOperation is an operation that would be performed against an LTM, it is returned
+// by the mutating endpoints when running in dry-run mode
+type PlannedOperation struct {
+	Step      string      `json:"step"`
+	Operation string      `json:"operation"`
+	Target    string      `json:"target"`
+	Before    interface{} `json:"before,omitempty"`
+	After     interface{} `json:"after,omitempty"`
+}
+
+// ClientSSLProfileDetail is an ltm client ssl profile with the details of its certificate
+type ClientSSLProfileDetail struct {
+	bigip.ClientSSLProfile
+	CertSubject    string     `json:"certSubject,omitempty"`
+	CertIssuer     string     `json:"certIssuer,omitempty"`
+	CertExpiration *time.Time `json:"certExpiration,omitempty"`
+}
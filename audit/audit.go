@@ -0,0 +1,249 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outcome is the result of an audited operation
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "succeeded"
+	OutcomeFailed    Outcome = "failed"
+)
+
+// Event is the record of a single change made to an LTM
+type Event struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"requestId,omitempty"`
+	JobID     string          `json:"jobId,omitempty"`
+	Identity  string          `json:"identity"`
+	Host      string          `json:"host"`
+	Object    string          `json:"object"`
+	Operation string          `json:"operation"`
+	Step      string          `json:"step"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Outcome   Outcome         `json:"outcome"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Sink is a destination for audit events
+type Sink interface {
+	Write(e *Event) error
+}
+
+// Filter selects audit events, empty fields match all events
+type Filter struct {
+	Identity  string
+	Host      string
+	Object    string
+	Operation string
+	Outcome   Outcome
+	Since     time.Time
+	Until     time.Time
+}
+
+// Logger records audit events to its sinks and keeps the most recent events in memory for querying
+type Logger struct {
+	mu        sync.RWMutex
+	sinks     []Sink
+	events    []Event
+	maxEvents int
+	filePath  string
+	file      *os.File
+}
+
+type LoggerOption func(*Logger)
+
+// New creates a new audit logger with options.  If a file is configured, the events already in the
+// file are loaded for querying and new events are appended to it.
+func New(opts ...LoggerOption) (*Logger, error) {
+	l := Logger{
+		sinks:     []Sink{},
+		events:    []Event{},
+		maxEvents: 10000,
+	}
+
+	for _, opt := range opts {
+		opt(&l)
+	}
+
+	if l.filePath != "" {
+		if err := l.load(); err != nil {
+			return nil, err
+		}
+
+		f, err := os.OpenFile(l.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, apierror.New(apierror.ErrInternalError, "failed to open audit log", err)
+		}
+		l.file = f
+		l.sinks = append(l.sinks, NewWriterSink(f))
+	}
+
+	return &l, nil
+}
+
+// WithFile appends audit events to the given file as JSON lines
+func WithFile(path string) LoggerOption {
+	return func(l *Logger) {
+		log.Debugf("setting audit log file to %s", path)
+		l.filePath = path
+	}
+}
+
+// WithStdout writes audit events to stdout as JSON lines
+func WithStdout() LoggerOption {
+	return func(l *Logger) {
+		log.Debug("writing audit events to stdout")
+		l.sinks = append(l.sinks, NewWriterSink(os.Stdout))
+	}
+}
+
+// WithSink writes audit events to the given sink
+func WithSink(s Sink) LoggerOption {
+	return func(l *Logger) {
+		l.sinks = append(l.sinks, s)
+	}
+}
+
+// WithMaxEvents sets the maximum number of events kept in memory for querying
+func WithMaxEvents(n int) LoggerOption {
+	return func(l *Logger) {
+		log.Debugf("setting max audit events to %d", n)
+		l.maxEvents = n
+	}
+}
+
+// Record writes the event to each of the sinks.  Failing to write to a sink is logged, it
+// doesn't fail the audited operation.
+func (l *Logger) Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.keep(e)
+
+	for _, s := range l.sinks {
+		if err := s.Write(&e); err != nil {
+			log.Errorf("failed to write audit event for %s %s on %s: %s", e.Action, e.Target, e.Host, err)
+		}
+	}
+}
+
+// Query returns the events matching the filter, newest first
+func (l *Logger) Query(f Filter) []Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	out := []Event{}
+	for i := len(l.events) - 1; i >= 0; i-- {
+		if f.match(&l.events[i]) {
+			out = append(out, l.events[i])
+		}
+	}
+
+	return out
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// keep adds the event to the in memory events.  It must be called with the lock held.
+func (l *Logger) keep(e Event) {
+	l.events = append(l.events, e)
+	if l.maxEvents > 0 && len(l.events) > l.maxEvents {
+		l.events = l.events[len(l.events)-l.maxEvents:]
+	}
+}
+
+// load reads the existing events from the audit log file
+func (l *Logger) load() error {
+	f, err := os.Open(l.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return apierror.New(apierror.ErrInternalError, "failed to read audit log", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		e := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Warnf("skipping invalid audit log line: %s", err)
+			continue
+		}
+		l.keep(e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to read audit log", err)
+	}
+
+	log.Infof("loaded %d audit events from %s", len(l.events), l.filePath)
+
+	return nil
+}
+
+func (f *Filter) match(e *Event) bool {
+	switch {
+	case f.Identity != "" && e.Identity != f.Identity:
+		return false
+	case f.Host != "" && e.Host != f.Host:
+		return false
+	case f.Object != "" && e.Object != f.Object:
+		return false
+	case f.Operation != "" && e.Operation != f.Operation:
+		return false
+	case f.Outcome != "" && e.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && e.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// WriterSink writes audit events to a writer as JSON lines
+type WriterSink struct {
+	w io.Writer
+}
+
+// NewWriterSink creates a sink writing JSON lines to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write writes the event as a single JSON line
+func (s *WriterSink) Write(e *Event) error {
+	j, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.w.Write(append(j, '\n'))
+	return err
+}
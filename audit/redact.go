@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// redacted replaces secret values in audit events
+const redacted = "[REDACTED]"
+
+// sensitiveFields are field names whose values are always redacted
+var sensitiveFields = map[string]bool{
+	"password":   true,
+	"passphrase": true,
+	"secret":     true,
+	"token":      true,
+}
+
+// Redact returns v as JSON with secrets replaced.  Fields named like passwords or tokens, and
+// any PEM encoded or base64 encoded PEM data (ie. private keys), are redacted.
+func Redact(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	j, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("failed to marshal audit state: %s", err)
+		return nil
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(j, &data); err != nil {
+		log.Errorf("failed to unmarshal audit state: %s", err)
+		return nil
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	out, err := json.Marshal(redact(data))
+	if err != nil {
+		log.Errorf("failed to marshal redacted audit state: %s", err)
+		return nil
+	}
+
+	return out
+}
+
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if sensitiveFields[strings.ToLower(k)] {
+				t[k] = redacted
+				continue
+			}
+			t[k] = redact(val)
+		}
+		return t
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redact(val)
+		}
+		return t
+	case string:
+		if isPEM(t) {
+			return redacted
+		}
+	}
+
+	return v
+}
+
+// isPEM returns true for PEM data or base64 encoded PEM data ('-----BEGIN' is 'LS0tLS1CRUdJTi' in base64)
+func isPEM(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "-----BEGIN") || strings.HasPrefix(s, "LS0tLS1CRUdJTi")
+}
@@ -17,21 +17,181 @@ You should have received a copy of the GNU Affero General Public License
 along with this program. If not, see <http://www.gnu.org/licenses/>.
 */
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
 )
 
 // Config is representation of the configuration data
 type Config struct {
 	ListenAddress string
+	TLS           *TLSConfig
+	CORS          CORSConfig
 	Accounts      map[string]Account
+	HostGroups    map[string]HostGroup
 	Token         string
+	Tokens        map[string]TokenConfig
+	OIDC          *OIDCConfig
+	Auth          AuthConfig
 	LogLevel      string
 	Version       Version
 	Org           string
+	Jobs          JobsConfig
+	Idempotency   IdempotencyConfig
+	Health        HealthConfig
+	Audit         AuditConfig
+	Secrets       SecretsConfig
+	Save          SaveConfig
+	// Revision identifies the loaded configuration, it's the start of the SHA-256 digest of the configuration data
+	// until it's set from the configuration in use with SetRevision
+	Revision string `json:"-"`
+}
+
+// TLSConfig is the configuration for serving the API over TLS
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM encoded serving certificate and key, they're reloaded when they change
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a PEM encoded CA bundle used to verify client certificates
+	ClientCAFile string
+	// RequireClientCert rejects connections without a verified client certificate
+	RequireClientCert bool
+	// Clients maps client certificate subjects, either the common name or the full distinguished name,
+	// to the access they're granted
+	Clients map[string]AccessConfig
+}
+
+// CORSConfig is the configuration for cross-origin requests from browsers, empty fields use the defaults
+type CORSConfig struct {
+	// AllowedOrigins are the allowed origins, '*' matches any characters (ie. "https://*.example.org"), defaults to all origins
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in preflight requests
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in preflight requests, "*" allows all headers
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to the browser, X-Request-Id is always exposed
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and client certificates to be sent, it can't be used with all origins
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request can be cached, ie. "10m"
+	MaxAge string
+}
+
+// AccessConfig is the access granted to an API token, an identity provider group or a client certificate
+type AccessConfig struct {
+	// Hosts are the LTM hosts that can be accessed, "*" allows all hosts
+	Hosts []string
+	// Objects are the object types that can be accessed (ie. "clientssl", "jobs"), "*" allows all types
+	Objects []string
+	// Scope is "ro" for read-only access or "rw" for read-write access
+	Scope string
+}
+
+// TokenConfig is a named API token and the access it's granted
+type TokenConfig struct {
+	// Token is the pre-shared key, clients send its bcrypt hash in the X-Auth-Token header
+	Token string
+	AccessConfig
+}
+
+// AuthConfig is the configuration for caching verified API tokens and limiting failed authentication attempts
+type AuthConfig struct {
+	// CacheTTL is how long a verified token is cached, ie. "5m", "0s" disables the cache
+	CacheTTL string
+	// CacheSize is the maximum number of verified tokens cached
+	CacheSize int
+	// MaxFailures is the number of failed attempts allowed from a client IP in the failure window, the limit is disabled unless it's set
+	MaxFailures int
+	// FailureWindow is the period failed attempts are counted over, ie. "1m"
+	FailureWindow string
+	// TrustedProxies are the CIDRs of the proxies, ie. the ingress or load balancer, whose X-Forwarded-For header is used for the client IP
+	TrustedProxies []string
+}
+
+// OIDCConfig is the configuration for authenticating with JWT bearer tokens issued by an identity provider
+type OIDCConfig struct {
+	// Issuer is the required iss claim
+	Issuer string
+	// Audience is the required aud claim
+	Audience string
+	// JWKSFile is a local file containing the JSON web key set used to verify tokens
+	JWKSFile string
+	// JWKSURL is the URL of the JSON web key set used to verify tokens
+	JWKSURL string
+	// JWKSRefresh is how often the key set is fetched from the JWKSURL, ie. "1h"
+	JWKSRefresh string
+	// UsernameClaim is the claim used as the caller's name, defaults to "sub"
+	UsernameClaim string
+	// GroupsClaim is the claim containing the caller's groups, defaults to "groups"
+	GroupsClaim string
+	// Groups maps groups to the access they're granted
+	Groups map[string]AccessConfig
+}
+
+// JobsConfig is the configuration for asynchronous jobs
+type JobsConfig struct {
+	// StorePath is an optional file used to persist the job history across restarts
+	StorePath string
+	// Retention is how long finished jobs are kept, ie. "24h"
+	Retention string
+	// MaxJobs is the maximum number of jobs kept in the history
+	MaxJobs int
+}
+
+// IdempotencyConfig is the configuration for Idempotency-Key handling on mutating requests
+type IdempotencyConfig struct {
+	// Window is how long the result of a request is replayed for duplicates, ie. "24h"
+	Window string
+}
+
+// HealthConfig is the configuration for the LTM probes used by the ready and health endpoints
+type HealthConfig struct {
+	// Policy decides when the service is ready, "all" configured hosts or "any" host must be reachable
+	Policy string
+	// Required is a list of hosts which must be reachable for the service to be ready, regardless of the policy
+	Required []string
+	// Timeout is how long to wait for each LTM to respond, ie. "5s"
+	Timeout string
+	// CacheTTL is how long probe results are cached, ie. "10s"
+	CacheTTL string
+}
+
+// AuditConfig is the configuration for the audit log of changes made to the LTMs
+type AuditConfig struct {
+	// File is an optional file the audit events are appended to as JSON lines, existing events are loaded at startup
+	File string
+	// Stdout writes the audit events to stdout as JSON lines
+	Stdout bool
+	// MaxEvents is the maximum number of events kept in memory for the audit endpoint
+	MaxEvents int
+}
+
+// SecretsConfig is the configuration for resolving 'ssm:' secret references
+type SecretsConfig struct {
+	// Region is the region of the SSM parameters, defaults to "us-east-1"
+	Region string
+	// RoleArn is an optional role assumed to get the SSM parameters
+	RoleArn string
+	// ExternalID is the external id used when assuming the role
+	ExternalID string
+}
+
+// SaveConfig is the configuration for saving the running configuration of the LTMs after changes
+type SaveConfig struct {
+	// Mode is "request" to save after each request that changes an LTM, "debounce" to save once an LTM
+	// hasn't changed for the delay, or empty to not save
+	Mode string
+	// Delay is how long to wait for more changes before saving in debounce mode, ie. "30s"
+	Delay string
 }
 
 // Version carries around the API version information
@@ -47,14 +207,158 @@ type Account struct {
 	UploadPath string
 	Username   string
 	Password   string
+	// Auth is "basic" (the default) to send the username and password with each request, or "token" to log in
+	// for an auth token, which is required for remote (ie. RADIUS or LDAP) accounts
+	Auth string
+	// LoginProvider is the login provider used for token auth, defaults to "tmos"
+	LoginProvider string
+	// TLS is how the certificate of the LTM's management interface is verified
+	TLS LTMTLSConfig
 }
 
-// ReadConfig decodes the configuration from an io Reader
+// HostGroup is a group of accounts, ie. an active/standby pair, that's used as a single host
+type HostGroup struct {
+	// Members are the names of the accounts in the group, reads use the active member or the first one that responds
+	Members []string
+	// SyncGroup is the name of the device group the members sync their configuration with
+	SyncGroup string
+	// AutoSync syncs the configuration to the sync group after changes are made
+	AutoSync bool
+	// SyncTimeout is how long to wait for the sync group to be in sync, ie. "30s"
+	SyncTimeout string
+}
+
+// LTMTLSConfig is the configuration for verifying the certificate of an LTM, by default it's verified against the system roots
+type LTMTLSConfig struct {
+	// CAFile is a PEM encoded CA bundle used to verify the certificate instead of the system roots
+	CAFile string
+	// PinnedSPKI is the base64 encoded SHA-256 digest of the certificate's public key, without a CAFile
+	// a certificate with the pinned key is trusted without verifying its chain or name
+	PinnedSPKI string
+	// ServerName is the name the certificate is verified for, defaults to the host name of the ltmHost
+	ServerName string
+	// InsecureSkipVerify disables certificate verification, it can't be used with a CAFile or PinnedSPKI
+	InsecureSkipVerify bool
+}
+
+const (
+	// FormatJSON is the JSON configuration format
+	FormatJSON = "json"
+	// FormatYAML is the YAML configuration format
+	FormatYAML = "yaml"
+)
+
+// ConfigFormat returns the format of a configuration file from its extension, or an empty string
+// if the extension isn't known and the format should be detected from the content
+func ConfigFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	}
+	return ""
+}
+
+// ReadConfig decodes the configuration from an io Reader, the format is detected from the content
 func ReadConfig(r io.Reader) (Config, error) {
+	return ReadConfigFormat(r, "")
+}
+
+// ReadConfigFormat decodes the configuration from an io Reader in the given format.  If the format
+// is empty, content starting with '{' is decoded as JSON and anything else as YAML.  Unknown keys
+// are rejected, since they're usually a misspelling of a setting that would otherwise be silently ignored.
+func ReadConfigFormat(r io.Reader, format string) (Config, error) {
 	var c Config
 	log.Infoln("decoding configuration...")
-	if err := json.NewDecoder(r).Decode(&c); err != nil {
-		return c, errors.Wrap(err, "unable to decode JSON message")
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return c, errors.Wrap(err, "unable to read configuration")
+	}
+
+	if format == "" {
+		format = FormatYAML
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			format = FormatJSON
+		}
 	}
+
+	switch format {
+	case FormatJSON:
+		if err := decodeJSON(data, &c, true); err != nil {
+			return c, errors.Wrap(err, "unable to decode JSON message")
+		}
+	case FormatYAML:
+		j, err := yaml.YAMLToJSONStrict(data)
+		if err != nil {
+			return c, errors.Wrap(err, "unable to decode YAML message")
+		}
+
+		// the line and column of the converted JSON don't match the YAML
+		if err := decodeJSON(j, &c, false); err != nil {
+			return c, errors.Wrap(err, "unable to decode YAML message")
+		}
+	default:
+		return c, errors.Errorf("unknown configuration format %q", format)
+	}
+
+	sum := sha256.Sum256(data)
+	c.Revision = hex.EncodeToString(sum[:])[:12]
+
 	return c, nil
 }
+
+// SetRevision sets the revision from the configuration as it's used, after the environment overrides
+// and secrets are applied, so a changed override or a rotated secret changes the revision even if the
+// configuration data didn't change
+func (c *Config) SetRevision() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode configuration")
+	}
+
+	sum := sha256.Sum256(data)
+	c.Revision = hex.EncodeToString(sum[:])[:12]
+
+	return nil
+}
+
+// decodeJSON strictly decodes a single JSON configuration object, optionally adding the position of errors
+func decodeJSON(data []byte, c *Config, position bool) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		if position {
+			return decodeError(data, dec, err)
+		}
+		return err
+	}
+
+	if dec.More() {
+		return errors.New("unexpected data after the configuration")
+	}
+
+	return nil
+}
+
+// decodeError adds the line and column of a syntax or type error to the error message
+func decodeError(data []byte, dec *json.Decoder, err error) error {
+	offset := dec.InputOffset()
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+
+	if offset <= 0 || offset > int64(len(data)) {
+		return err
+	}
+
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+
+	return fmt.Errorf("line %d, column %d: %s", line, column, err)
+}
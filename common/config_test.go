@@ -18,7 +18,10 @@ package common
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -56,6 +59,9 @@ func TestReadConfig(t *testing.T) {
 		},
 	}
 
+	sum := sha256.Sum256(testConfig)
+	expectedConfig.Revision = hex.EncodeToString(sum[:])[:12]
+
 	actualConfig, err := ReadConfig(bytes.NewReader(testConfig))
 	if err != nil {
 		t.Error("Failed to read config", err)
@@ -70,3 +76,318 @@ func TestReadConfig(t *testing.T) {
 		t.Error("expected error reading config, got nil")
 	}
 }
+
+func TestReadConfigStrict(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":   "{\n  \"org\": \"test\",\n  \"account\": {}\n}",
+		"wrong type":    "{\n  \"org\": \"test\",\n  \"accounts\": []\n}",
+		"trailing data": "{\"org\": \"test\"} {}",
+	}
+
+	expected := map[string]string{
+		"unknown key": `unknown field "account"`,
+		"wrong type":  "line 3",
+	}
+
+	for name, data := range tests {
+		_, err := ReadConfig(bytes.NewReader([]byte(data)))
+		if err == nil {
+			t.Errorf("expected error for %s", name)
+			continue
+		}
+
+		if e, ok := expected[name]; ok && !strings.Contains(err.Error(), e) {
+			t.Errorf("expected error for %s to contain %q, got %s", name, e, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Config{
+		Org:      "test",
+		Token:    "sekret",
+		LogLevel: "info",
+		Accounts: map[string]Account{
+			"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "env:LTM1_PASSWORD", UploadPath: "/var/config/rest/downloads"},
+			"ltm2": {LTMHost: "https://ltm2.example.org:8443", Username: "api", Password: "sekret"},
+			"ltm3": {LTMHost: "ltm3.example.org", Username: "api", Password: "sekret", TLS: LTMTLSConfig{
+				CAFile:     "/etc/f5-api/ca.pem",
+				PinnedSPKI: "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+			}},
+			"ltm4": {LTMHost: "ltm4.example.org", Username: "api", Password: "sekret", Auth: "token", LoginProvider: "radius"},
+		},
+		HostGroups: map[string]HostGroup{
+			"pair": {Members: []string{"ltm1", "ltm2"}, SyncGroup: "sync-failover", AutoSync: true, SyncTimeout: "1m"},
+		},
+		Save: SaveConfig{Mode: "debounce", Delay: "30s"},
+		Auth: AuthConfig{TrustedProxies: []string{"10.0.0.0/8", "fd00::/8"}},
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected nil error, got %s", err)
+	}
+
+	invalid := Config{
+		LogLevel: "infos",
+		Tokens:   map[string]TokenConfig{"portal": {}},
+		Accounts: map[string]Account{
+			"a": {LTMHost: "ltm1.example.org", Username: "api", Password: "sekret"},
+			"b": {LTMHost: "LTM1.example.org:443", Username: "api", Password: "sekret"},
+			"c": {LTMHost: "http://ltm3.example.org"},
+			"d": {LTMHost: "ltm4.example.org/mgmt", Username: "api", Password: "sekret", UploadPath: "downloads"},
+			"e": {LTMHost: "ltm5.example.org:99999", Username: "api", Password: "sekret"},
+			"f": {LTMHost: "ltm6.example.org", Username: "api", Password: "sekret", TLS: LTMTLSConfig{InsecureSkipVerify: true, CAFile: "/etc/f5-api/ca.pem"}},
+			"g": {LTMHost: "ltm7.example.org", Username: "api", Password: "sekret", TLS: LTMTLSConfig{PinnedSPKI: "sha256/abc"}},
+			"h": {LTMHost: "ltm8.example.org", Username: "api", Password: "sekret", Auth: "radius"},
+			"i": {LTMHost: "ltm9.example.org", Username: "api", Password: "sekret", LoginProvider: "radius"},
+		},
+		HostGroups: map[string]HostGroup{
+			"a":      {Members: []string{"b"}},
+			"empty":  {},
+			"nosync": {Members: []string{"a"}, AutoSync: true, SyncTimeout: "soon"},
+			"pair":   {Members: []string{"a", "missing", "a"}},
+		},
+		Save: SaveConfig{Mode: "always", Delay: "-1s"},
+		Auth: AuthConfig{TrustedProxies: []string{"10.0.0.1"}},
+	}
+
+	err := invalid.Validate()
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+
+	expected := []string{
+		"org is required",
+		`logLevel "infos"`,
+		"tokens.portal: token is required",
+		"accounts.b.ltmHost: LTM1.example.org:443 is also used by account a",
+		"accounts.c.ltmHost: \"http://ltm3.example.org\" must use https",
+		"accounts.c.username is required",
+		"accounts.c.password is required",
+		"accounts.d.ltmHost",
+		"accounts.d.uploadPath must be an absolute path",
+		"accounts.e.ltmHost",
+		"accounts.f.tls.insecureSkipVerify can't be used with a caFile or pinnedSPKI",
+		"accounts.g.tls.pinnedSPKI must be a base64 encoded SHA-256 digest",
+		`accounts.h.auth "radius" must be basic or token`,
+		"accounts.i.loginProvider can only be used with token auth",
+		"hostGroups.a: the name is also used by an account",
+		"hostGroups.empty: at least one member is required",
+		"hostGroups.nosync: autoSync requires a syncGroup",
+		`hostGroups.nosync: syncTimeout "soon" must be a positive duration`,
+		"hostGroups.pair: member missing isn't an account",
+		"hostGroups.pair: member a is listed more than once",
+		`auth.trustedProxies: "10.0.0.1" is not a CIDR`,
+		`save.mode "always" must be request or debounce`,
+		`save.delay "-1s" must be a positive duration`,
+	}
+
+	if len(verr.Problems) != len(expected) {
+		t.Errorf("expected %d problems, got %d: %s", len(expected), len(verr.Problems), err)
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("expected problem %q, got %s", e, err)
+		}
+	}
+
+	if err := (&Config{Org: "test", Accounts: valid.Accounts}).Validate(); err == nil {
+		t.Error("expected error without any authentication")
+	}
+}
+
+func TestSummary(t *testing.T) {
+	c := Config{
+		Org:    "test",
+		Token:  "x",
+		Tokens: map[string]TokenConfig{"portal": {Token: "portal-sekret"}},
+		Accounts: map[string]Account{
+			"ltm1": {LTMHost: "ltm1.example.org", Username: "api", Password: "ltm1-sekret"},
+			"ltm2": {LTMHost: "ltm2.example.org", Username: "api", Password: "ssm:/f5-api/ltm2/password"},
+		},
+	}
+
+	summary := c.Summary()
+	for _, secret := range []string{"portal-sekret", "ltm1-sekret", "Token: x"} {
+		if strings.Contains(summary, secret) {
+			t.Errorf("expected %q to be redacted from the summary:\n%s", secret, summary)
+		}
+	}
+
+	if !strings.Contains(summary, "ssm:/f5-api/ltm2/password") {
+		t.Errorf("expected secret references in the summary:\n%s", summary)
+	}
+}
+
+func TestReadConfigYAML(t *testing.T) {
+	yamlConfig := []byte(`# the same configuration as testConfig
+listenAddress: ":8000"
+accounts:
+  www.example.org:
+    ltmhost: www.example.org
+    username: user1
+    password: 1badpass
+    uploadpath: /foobar
+token: SEKRET
+logLevel: infos
+org: test
+`)
+
+	expected, err := ReadConfig(bytes.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"", FormatYAML} {
+		actual, err := ReadConfigFormat(bytes.NewReader(yamlConfig), format)
+		if err != nil {
+			t.Fatalf("expected nil error for format %q, got %s", format, err)
+		}
+
+		if actual.Revision == "" || actual.Revision == expected.Revision {
+			t.Errorf("expected the revision of the YAML data, got %q", actual.Revision)
+		}
+
+		actual.Revision = expected.Revision
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected config to be %+v\n got %+v", expected, actual)
+		}
+	}
+
+	// JSON is valid YAML
+	if _, err := ReadConfigFormat(bytes.NewReader(testConfig), FormatYAML); err != nil {
+		t.Errorf("expected nil error reading JSON as YAML, got %s", err)
+	}
+
+	tests := map[string]string{
+		"unknown key":   "org: test\naccount: {}\n",
+		"duplicate key": "org: test\norg: test2\n",
+		"wrong type":    "org: test\naccounts: []\n",
+		"broken":        "org: [test\n",
+	}
+
+	for name, data := range tests {
+		if _, err := ReadConfig(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+
+	if _, err := ReadConfigFormat(bytes.NewReader(testConfig), "toml"); err == nil {
+		t.Error("expected error for an unknown format")
+	}
+}
+
+func TestConfigFormat(t *testing.T) {
+	tests := map[string]string{
+		"config/config.json": FormatJSON,
+		"config/config.yaml": FormatYAML,
+		"config/config.YML":  FormatYAML,
+		"config/config":      "",
+		"config/config.conf": "",
+	}
+
+	for path, expected := range tests {
+		if out := ConfigFormat(path); out != expected {
+			t.Errorf("expected format %q for %s, got %q", expected, path, out)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	config, err := ReadConfig(bytes.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Tokens = map[string]TokenConfig{"portal-app": {Token: "one", AccessConfig: AccessConfig{Scope: "ro"}}}
+	original := config.Accounts
+
+	applied, err := config.ApplyEnv([]string{
+		"PATH=/usr/bin",
+		"F5API_LISTENADDRESS=:9000",
+		"F5API_LOGLEVEL=debug",
+		"F5API_HEALTH_TIMEOUT=2s",
+		"F5API_AUDIT_STDOUT=true",
+		"F5API_JOBS_MAXJOBS=50",
+		"F5API_ACCOUNTS_WWW_EXAMPLE_ORG_PASSWORD=env:LTM_PASSWORD",
+		"F5API_ACCOUNTS_OTHER_EXAMPLE_ORG_PASSWORD=ignored",
+		"F5API_TOKENS_PORTAL_APP_SCOPE=rw",
+		"F5API_OIDC_ISSUER=https://idp.example.org",
+		"F5API_REVISION=ignored",
+	})
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if len(applied) != 8 {
+		t.Errorf("expected 8 settings to be applied, got %v", applied)
+	}
+
+	if config.ListenAddress != ":9000" || config.LogLevel != "debug" || config.Health.Timeout != "2s" || !config.Audit.Stdout || config.Jobs.MaxJobs != 50 {
+		t.Errorf("unexpected settings %+v", config)
+	}
+
+	if config.Accounts["www.example.org"].Password != "env:LTM_PASSWORD" || config.Accounts["www.example.org"].Username != "user1" {
+		t.Errorf("unexpected account %+v", config.Accounts["www.example.org"])
+	}
+
+	if len(config.Accounts) != 1 {
+		t.Errorf("expected accounts not to be added from the environment, got %+v", config.Accounts)
+	}
+
+	if original["www.example.org"].Password != "1badpass" {
+		t.Error("expected the original accounts to be unchanged")
+	}
+
+	if config.Tokens["portal-app"].Scope != "rw" || config.Tokens["portal-app"].Token != "one" {
+		t.Errorf("unexpected token %+v", config.Tokens["portal-app"])
+	}
+
+	if config.OIDC == nil || config.OIDC.Issuer != "https://idp.example.org" {
+		t.Errorf("expected the oidc issuer to be set, got %+v", config.OIDC)
+	}
+
+	if config.TLS != nil {
+		t.Errorf("expected tls to be unset, got %+v", config.TLS)
+	}
+
+	if config.Revision == "ignored" {
+		t.Error("expected the revision not to be overridden")
+	}
+
+	for _, env := range []string{"F5API_JOBS_MAXJOBS=many", "F5API_AUDIT_STDOUT=sometimes"} {
+		if _, err := config.ApplyEnv([]string{env}); err == nil {
+			t.Errorf("expected error for %s", env)
+		}
+	}
+
+	if name := EnvName("Accounts", "ltm1.example.org", "Password"); name != "F5API_ACCOUNTS_LTM1_EXAMPLE_ORG_PASSWORD" {
+		t.Errorf("unexpected env name %s", name)
+	}
+}
+
+func TestSetRevision(t *testing.T) {
+	config, err := ReadConfig(bytes.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := config.Revision
+
+	if err := config.SetRevision(); err != nil {
+		t.Fatal(err)
+	}
+	first := config.Revision
+
+	if _, err := config.ApplyEnv([]string{"F5API_LISTENADDRESS=:9000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.SetRevision(); err != nil {
+		t.Fatal(err)
+	}
+
+	if first == "" || config.Revision == first || config.Revision == read {
+		t.Errorf("expected an override to change the revision, got %s, %s and %s", read, first, config.Revision)
+	}
+}
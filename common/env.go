@@ -0,0 +1,151 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables that override configuration settings
+const EnvPrefix = "F5API_"
+
+// EnvName returns the environment variable name for a configuration setting path, ie.
+// ("Accounts", "ltm1.example.org", "Password") is F5API_ACCOUNTS_LTM1_EXAMPLE_ORG_PASSWORD.
+// Characters other than letters and digits are replaced with underscores.
+func EnvName(path ...string) string {
+	name := strings.TrimSuffix(EnvPrefix, "_")
+	for _, p := range path {
+		name = envJoin(name, p)
+	}
+	return name
+}
+
+// envJoin appends a setting or map key to an environment variable name
+func envJoin(name, part string) string {
+	return name + "_" + strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(part))
+}
+
+// ApplyEnv overrides the scalar settings in the configuration with F5API_* variables from environ,
+// which is in the form returned by os.Environ.  Settings in maps, like the accounts, can only be
+// overridden for entries that are in the configuration.  It returns the names of the variables
+// that were applied.
+func (c *Config) ApplyEnv(environ []string) ([]string, error) {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) {
+			env[k] = v
+		}
+	}
+
+	if len(env) == 0 {
+		return nil, nil
+	}
+
+	applied := []string{}
+	if err := applyEnv(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), env, &applied); err != nil {
+		return nil, err
+	}
+	sort.Strings(applied)
+
+	return applied, nil
+}
+
+// applyEnv sets the value v, named name, from the environment
+func applyEnv(v reflect.Value, name string, env map[string]string, applied *[]string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+
+			// embedded fields are promoted, like they are in JSON
+			fieldName := name
+			if !f.Anonymous {
+				fieldName = envJoin(name, f.Name)
+			}
+
+			if err := applyEnv(v.Field(i), fieldName, env, applied); err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+
+		if v.IsNil() {
+			if !hasEnvPrefix(env, name+"_") {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+
+		return applyEnv(v.Elem(), name, env, applied)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String || v.Type().Elem().Kind() != reflect.Struct {
+			return nil
+		}
+
+		// copy the map, so the original configuration isn't changed
+		out := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+
+			if err := applyEnv(elem, envJoin(name, iter.Key().String()), env, applied); err != nil {
+				return err
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+
+		if !v.IsNil() {
+			v.Set(out)
+		}
+	case reflect.String:
+		if s, ok := env[name]; ok {
+			v.SetString(s)
+			*applied = append(*applied, name)
+		}
+	case reflect.Bool:
+		if s, ok := env[name]; ok {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not a boolean", name, s)
+			}
+			v.SetBool(b)
+			*applied = append(*applied, name)
+		}
+	case reflect.Int, reflect.Int64:
+		if s, ok := env[name]; ok {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not an integer", name, s)
+			}
+			v.SetInt(n)
+			*applied = append(*applied, name)
+		}
+	}
+
+	return nil
+}
+
+// hasEnvPrefix returns true if any of the environment variables start with prefix
+func hasEnvPrefix(env map[string]string, prefix string) bool {
+	for k := range env {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,303 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// secretReferencePrefixes are the prefixes of values resolved from a secret store, they're shown in the summary
+var secretReferencePrefixes = []string{"env:", "file:", "ssm:"}
+
+// ValidationError is the list of problems found in the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+// Validate checks the configuration for the problems that would stop the API from working, it
+// returns a ValidationError listing all of the problems found
+func (c *Config) Validate() error {
+	problems := []string{}
+	problemf := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if strings.TrimSpace(c.Org) == "" {
+		problemf("org is required")
+	}
+
+	switch c.LogLevel {
+	case "", "error", "warn", "info", "debug":
+	default:
+		problemf("logLevel %q must be one of error, warn, info or debug", c.LogLevel)
+	}
+
+	if c.Token != "" && strings.TrimSpace(c.Token) != c.Token {
+		problemf("token has leading or trailing whitespace")
+	}
+
+	clientCerts := c.TLS != nil && len(c.TLS.Clients) > 0
+	if c.Token == "" && len(c.Tokens) == 0 && c.OIDC == nil && !clientCerts {
+		problemf("token is required when no named tokens, oidc or tls clients are configured")
+	}
+
+	for _, name := range sortedKeys(c.Tokens) {
+		if c.Tokens[name].Token == "" {
+			problemf("tokens.%s: token is required", name)
+		}
+	}
+
+	if len(c.Accounts) == 0 {
+		problemf("accounts: at least one account is required")
+	}
+
+	hosts := map[string]string{}
+	for _, name := range sortedKeys(c.Accounts) {
+		a := c.Accounts[name]
+
+		host, err := normalizeHost(a.LTMHost)
+		if err != nil {
+			problemf("accounts.%s.ltmHost: %s", name, err)
+		} else if other, ok := hosts[host]; ok {
+			problemf("accounts.%s.ltmHost: %s is also used by account %s", name, a.LTMHost, other)
+		} else {
+			hosts[host] = name
+		}
+
+		if a.Username == "" {
+			problemf("accounts.%s.username is required", name)
+		}
+
+		if a.Password == "" {
+			problemf("accounts.%s.password is required", name)
+		}
+
+		if a.UploadPath != "" && !strings.HasPrefix(a.UploadPath, "/") {
+			problemf("accounts.%s.uploadPath must be an absolute path", name)
+		}
+
+		switch a.Auth {
+		case "", "basic":
+			if a.LoginProvider != "" {
+				problemf("accounts.%s.loginProvider can only be used with token auth", name)
+			}
+		case "token":
+		default:
+			problemf("accounts.%s.auth %q must be basic or token", name, a.Auth)
+		}
+
+		if a.TLS.InsecureSkipVerify && (a.TLS.CAFile != "" || a.TLS.PinnedSPKI != "") {
+			problemf("accounts.%s.tls.insecureSkipVerify can't be used with a caFile or pinnedSPKI", name)
+		}
+
+		if a.TLS.PinnedSPKI != "" {
+			if pin, err := base64.StdEncoding.DecodeString(a.TLS.PinnedSPKI); err != nil || len(pin) != sha256.Size {
+				problemf("accounts.%s.tls.pinnedSPKI must be a base64 encoded SHA-256 digest", name)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(c.HostGroups) {
+		g := c.HostGroups[name]
+
+		if _, ok := c.Accounts[name]; ok {
+			problemf("hostGroups.%s: the name is also used by an account", name)
+		}
+
+		if len(g.Members) == 0 {
+			problemf("hostGroups.%s: at least one member is required", name)
+		}
+
+		if g.AutoSync && g.SyncGroup == "" {
+			problemf("hostGroups.%s: autoSync requires a syncGroup", name)
+		}
+
+		if g.SyncTimeout != "" {
+			if d, err := time.ParseDuration(g.SyncTimeout); err != nil || d <= 0 {
+				problemf("hostGroups.%s: syncTimeout %q must be a positive duration", name, g.SyncTimeout)
+			}
+		}
+
+		members := map[string]bool{}
+		for _, m := range g.Members {
+			if _, ok := c.Accounts[m]; !ok {
+				problemf("hostGroups.%s: member %s isn't an account", name, m)
+			}
+
+			if members[m] {
+				problemf("hostGroups.%s: member %s is listed more than once", name, m)
+			}
+			members[m] = true
+		}
+	}
+
+	for _, cidr := range c.Auth.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			problemf("auth.trustedProxies: %q is not a CIDR", cidr)
+		}
+	}
+
+	switch c.Save.Mode {
+	case "", "request", "debounce":
+	default:
+		problemf("save.mode %q must be request or debounce", c.Save.Mode)
+	}
+
+	if c.Save.Delay != "" {
+		if d, err := time.ParseDuration(c.Save.Delay); err != nil || d <= 0 {
+			problemf("save.delay %q must be a positive duration", c.Save.Delay)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+// normalizeHost checks the ltm host is a host name or address with an optional port and https
+// scheme, and returns it in lower case with the default port
+func normalizeHost(h string) (string, error) {
+	if h == "" {
+		return "", fmt.Errorf("is required")
+	}
+
+	if strings.ContainsAny(h, " \t\r\n") {
+		return "", fmt.Errorf("%q contains whitespace", h)
+	}
+
+	raw := h
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a valid host: %s", h, err)
+	}
+
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("%q must use https", h)
+	}
+
+	if u.Hostname() == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return "", fmt.Errorf("%q must be a host name with an optional port", h)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	} else if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return "", fmt.Errorf("%q has an invalid port", h)
+	}
+
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port), nil
+}
+
+// Summary returns a description of the configuration with the secrets redacted
+func (c *Config) Summary() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "ListenAddress: %s\n", c.ListenAddress)
+	fmt.Fprintf(&b, "Org: %s\n", c.Org)
+	fmt.Fprintf(&b, "LogLevel: %s\n", c.LogLevel)
+	fmt.Fprintf(&b, "Token: %s\n", redact(c.Token))
+
+	for _, name := range sortedKeys(c.Tokens) {
+		t := c.Tokens[name]
+		fmt.Fprintf(&b, "Tokens.%s: %s, Hosts: %v, Objects: %v, Scope: %s\n", name, redact(t.Token), t.Hosts, t.Objects, t.Scope)
+	}
+
+	if c.OIDC != nil {
+		fmt.Fprintf(&b, "OIDC: Issuer: %s, Audience: %s\n", c.OIDC.Issuer, c.OIDC.Audience)
+	}
+
+	if c.TLS != nil {
+		fmt.Fprintf(&b, "TLS: CertFile: %s, ClientCAFile: %s, Clients: %d\n", c.TLS.CertFile, c.TLS.ClientCAFile, len(c.TLS.Clients))
+	}
+
+	for _, name := range sortedKeys(c.Accounts) {
+		a := c.Accounts[name]
+		fmt.Fprintf(&b, "Accounts.%s: LTMHost: %s, Username: %s, Password: %s, UploadPath: %s, Auth: %s, TLS: %s\n", name, a.LTMHost, a.Username, redact(a.Password), a.UploadPath, authSummary(a), tlsSummary(a.TLS))
+	}
+
+	for _, name := range sortedKeys(c.HostGroups) {
+		g := c.HostGroups[name]
+		fmt.Fprintf(&b, "HostGroups.%s: Members: %v, SyncGroup: %s, AutoSync: %t\n", name, g.Members, g.SyncGroup, g.AutoSync)
+	}
+
+	return b.String()
+}
+
+// authSummary describes how the ltm account authenticates
+func authSummary(a Account) string {
+	if a.Auth != "token" {
+		return "basic"
+	}
+
+	if a.LoginProvider == "" {
+		return "token (tmos)"
+	}
+
+	return fmt.Sprintf("token (%s)", a.LoginProvider)
+}
+
+// tlsSummary describes how the certificate of an ltm is verified
+func tlsSummary(t LTMTLSConfig) string {
+	if t.InsecureSkipVerify {
+		return "insecure"
+	}
+
+	parts := []string{}
+	if t.CAFile != "" {
+		parts = append(parts, "CAFile: "+t.CAFile)
+	} else if t.PinnedSPKI == "" {
+		parts = append(parts, "system roots")
+	}
+
+	if t.PinnedSPKI != "" {
+		parts = append(parts, "PinnedSPKI: "+t.PinnedSPKI)
+	}
+
+	if t.ServerName != "" {
+		parts = append(parts, "ServerName: "+t.ServerName)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// redact hides a secret value, secret references are shown since they don't contain the secret
+func redact(v string) string {
+	if v == "" {
+		return "<not set>"
+	}
+
+	for _, p := range secretReferencePrefixes {
+		if strings.HasPrefix(v, p) {
+			return v
+		}
+	}
+
+	return "********"
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -6,6 +6,7 @@ require (
 	github.com/YaleSpinup/apierror v0.1.5
 	github.com/YaleUniversity/go-bigip v0.1.1
 	github.com/aws/aws-sdk-go v1.47.9
+	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.4.0
 	github.com/gorilla/handlers v1.5.2
 	github.com/gorilla/mux v1.8.1
@@ -13,6 +14,7 @@ require (
 	github.com/prometheus/client_golang v1.17.0
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.15.0
+	sigs.k8s.io/yaml v1.4.0
 )
 
 require (
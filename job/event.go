@@ -0,0 +1,127 @@
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventType is the kind of job event
+type EventType string
+
+const (
+	// EventTypeJob is published when the status of a job changes
+	EventTypeJob EventType = "job"
+	// EventTypeStep is published when a step starts or finishes
+	EventTypeStep EventType = "step"
+	// EventTypeReset is the last event sent to a subscriber that's disconnected for falling
+	// behind, the subscriber has missed events and should subscribe again for a new snapshot
+	EventTypeReset EventType = "reset"
+)
+
+// subscriberBuffer is the number of events buffered for each subscriber.  Subscribers that
+// fall further behind than this are disconnected.  Each channel has room for one more event,
+// so the reset event can always be sent.
+const subscriberBuffer = 64
+
+// Event is a change in the progress of a job
+type Event struct {
+	Type   EventType       `json:"type"`
+	JobID  string          `json:"jobId"`
+	Status Status          `json:"status"`
+	Step   *Step           `json:"step,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Time   time.Time       `json:"time"`
+}
+
+// Subscribe returns a snapshot of the job with the given id and a channel of events for
+// everything that happens to the job after the snapshot was taken.  The channel is closed
+// when the job finishes, or immediately if the job has already finished.  A subscriber that
+// falls behind is sent a reset event before the channel is closed.  The returned cancel function
+// must be called to release the subscription.
+func (m *Manager) Subscribe(id string) (*Job, <-chan Event, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, nil, apierror.New(apierror.ErrNotFound, fmt.Sprintf("job %s not found", id), nil)
+	}
+
+	ch := make(chan Event, subscriberBuffer+1)
+	if j.Done() {
+		close(ch)
+		return j.copy(), ch, func() {}, nil
+	}
+
+	m.subscribers[id] = append(m.subscribers[id], ch)
+
+	cancel := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.unsubscribe(id, ch)
+	}
+
+	return j.copy(), ch, cancel, nil
+}
+
+// publish sends an event to the subscribers of a job.  Subscribers with a full buffer are sent
+// a reset event and disconnected.  It must be called with the lock held.
+func (m *Manager) publish(id string, e Event) {
+	slow := []chan Event{}
+	for _, ch := range m.subscribers[id] {
+		if len(ch) >= subscriberBuffer {
+			slow = append(slow, ch)
+			continue
+		}
+		ch <- e
+	}
+
+	status := e.Status
+	if j, ok := m.jobs[id]; ok {
+		status = j.Status
+	}
+
+	for _, ch := range slow {
+		log.Warnf("job %s event subscriber is too slow, disconnecting", id)
+
+		// the channel has room for the reset event, since only publish fills the buffer
+		ch <- Event{
+			Type:   EventTypeReset,
+			JobID:  id,
+			Status: status,
+			Error:  "subscriber fell behind, events were dropped",
+			Time:   time.Now().UTC(),
+		}
+		m.unsubscribe(id, ch)
+	}
+}
+
+// unsubscribe removes and closes a subscriber channel.  It must be called with the lock held.
+func (m *Manager) unsubscribe(id string, ch chan Event) {
+	subs := m.subscribers[id]
+	for i, s := range subs {
+		if s == ch {
+			close(ch)
+			m.subscribers[id] = append(subs[:i], subs[i+1:]...)
+			break
+		}
+	}
+
+	if len(m.subscribers[id]) == 0 {
+		delete(m.subscribers, id)
+	}
+}
+
+// closeSubscribers closes all of the subscriber channels for a job.  It must be called with
+// the lock held.
+func (m *Manager) closeSubscribers(id string) {
+	for _, ch := range m.subscribers[id] {
+		close(ch)
+	}
+	delete(m.subscribers, id)
+}
@@ -0,0 +1,375 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Status is the state of a job or one of its steps
+type Status string
+
+const (
+	StatusPending     Status = "pending"
+	StatusRunning     Status = "running"
+	StatusSucceeded   Status = "succeeded"
+	StatusFailed      Status = "failed"
+	StatusInterrupted Status = "interrupted"
+)
+
+// Step is a single orchestration step executed by a job
+type Step struct {
+	Name       string     `json:"name"`
+	Status     Status     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Job is a long running operation executed in the background
+type Job struct {
+	ID         string          `json:"id"`
+	Operation  string          `json:"operation"`
+	Host       string          `json:"host"`
+	Object     string          `json:"object"`
+	Status     Status          `json:"status"`
+	Steps      []Step          `json:"steps"`
+	Output     json.RawMessage `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// Done returns true if the job has finished running
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusInterrupted
+}
+
+// Func is the work executed by a job, the returned output is stored with the job
+type Func func(ctx context.Context, t *Tracker) (interface{}, error)
+
+// Manager runs jobs and keeps track of their state
+type Manager struct {
+	mu          sync.RWMutex
+	persistMu   sync.Mutex
+	jobs        map[string]*Job
+	subscribers map[string][]chan Event
+	storePath   string
+	retention   time.Duration
+	maxJobs     int
+}
+
+type ManagerOption func(*Manager)
+
+// New creates a new job manager with options.  If a store path is configured, previously
+// persisted jobs are loaded and any job that was running is marked as interrupted.
+func New(opts ...ManagerOption) (*Manager, error) {
+	m := Manager{
+		jobs:        make(map[string]*Job),
+		subscribers: make(map[string][]chan Event),
+		retention:   24 * time.Hour,
+		maxJobs:     1000,
+	}
+
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	if m.storePath != "" {
+		if err := m.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+// WithStorePath persists the job history to the given file
+func WithStorePath(path string) ManagerOption {
+	return func(m *Manager) {
+		log.Debugf("setting job store path to %s", path)
+		m.storePath = path
+	}
+}
+
+// WithRetention sets how long finished jobs are kept
+func WithRetention(d time.Duration) ManagerOption {
+	return func(m *Manager) {
+		log.Debugf("setting job retention to %s", d)
+		m.retention = d
+	}
+}
+
+// WithMaxJobs sets the maximum number of jobs kept in history
+func WithMaxJobs(n int) ManagerOption {
+	return func(m *Manager) {
+		log.Debugf("setting max jobs to %d", n)
+		m.maxJobs = n
+	}
+}
+
+// Start creates a new job and executes f in the background with the given context
+func (m *Manager) Start(ctx context.Context, operation, host, object string, f Func) (*Job, error) {
+	if operation == "" || f == nil {
+		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	j := &Job{
+		ID:        uuid.New().String(),
+		Operation: operation,
+		Host:      host,
+		Object:    object,
+		Status:    StatusPending,
+		Steps:     []Step{},
+		CreatedAt: time.Now().UTC(),
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[j.ID] = j
+	out := j.copy()
+	m.mu.Unlock()
+
+	m.persist()
+
+	log.Infof("starting job %s (%s %s on %s)", j.ID, operation, object, host)
+
+	go m.run(ctx, j.ID, f)
+
+	return out, nil
+}
+
+// Get returns a snapshot of the job with the given id
+func (m *Manager) Get(id string) (*Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	j, ok := m.jobs[id]
+	if !ok {
+		return nil, apierror.New(apierror.ErrNotFound, fmt.Sprintf("job %s not found", id), nil)
+	}
+
+	return j.copy(), nil
+}
+
+// List returns a snapshot of all of the jobs, newest first
+func (m *Manager) List() []*Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		jobs = append(jobs, j.copy())
+	}
+
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].CreatedAt.After(jobs[k].CreatedAt)
+	})
+
+	return jobs
+}
+
+func (m *Manager) run(ctx context.Context, id string, f Func) {
+	m.update(id, func(j *Job) *Event {
+		now := time.Now().UTC()
+		j.Status = StatusRunning
+		j.StartedAt = &now
+		return &Event{Type: EventTypeJob, Status: j.Status, Time: now}
+	})
+
+	t := &Tracker{id: id, manager: m}
+
+	out, err := func() (out interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return f(ctx, t)
+	}()
+
+	var output json.RawMessage
+	if err == nil && out != nil {
+		o, merr := json.Marshal(out)
+		if merr != nil {
+			err = apierror.New(apierror.ErrInternalError, "failed to marshal job output", merr)
+		} else {
+			output = o
+		}
+	}
+
+	m.update(id, func(j *Job) *Event {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		j.Output = output
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = errorMessage(err)
+		} else {
+			j.Status = StatusSucceeded
+		}
+		return &Event{Type: EventTypeJob, Status: j.Status, Error: j.Error, Output: output, Time: now}
+	})
+
+	if err != nil {
+		log.Errorf("job %s failed: %s", id, err)
+		return
+	}
+
+	log.Infof("job %s succeeded", id)
+}
+
+// update applies f to the job with the given id, publishes the returned event to the
+// job's subscribers and persists the result
+func (m *Manager) update(id string, f func(j *Job) *Event) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	if ok {
+		if e := f(j); e != nil {
+			e.JobID = id
+			m.publish(id, *e)
+		}
+
+		if j.Done() {
+			m.closeSubscribers(id)
+		}
+	}
+	m.mu.Unlock()
+
+	if ok {
+		m.persist()
+	}
+}
+
+// prune removes finished jobs older than the retention period and trims the history
+// to the maximum number of jobs.  It must be called with the lock held.
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-m.retention)
+
+	finished := []*Job{}
+	for id, j := range m.jobs {
+		if !j.Done() {
+			continue
+		}
+
+		if m.retention > 0 && j.FinishedAt != nil && j.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+			continue
+		}
+
+		finished = append(finished, j)
+	}
+
+	if m.maxJobs <= 0 || len(m.jobs) < m.maxJobs {
+		return
+	}
+
+	sort.Slice(finished, func(i, k int) bool {
+		return finished[i].CreatedAt.Before(finished[k].CreatedAt)
+	})
+
+	for _, j := range finished {
+		if len(m.jobs) < m.maxJobs {
+			break
+		}
+		delete(m.jobs, j.ID)
+	}
+}
+
+// persist writes the job history to the store path, if one is configured
+func (m *Manager) persist() {
+	if m.storePath == "" {
+		return
+	}
+
+	// serialize writers so an older snapshot never replaces a newer one
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	m.mu.RLock()
+	data, err := json.Marshal(m.jobs)
+	m.mu.RUnlock()
+	if err != nil {
+		log.Errorf("failed to marshal job history: %s", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.storePath), ".jobs-*")
+	if err != nil {
+		log.Errorf("failed to persist job history: %s", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Errorf("failed to persist job history: %s", err)
+		return
+	}
+
+	if err := tmp.Close(); err != nil {
+		log.Errorf("failed to persist job history: %s", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), m.storePath); err != nil {
+		log.Errorf("failed to persist job history: %s", err)
+	}
+}
+
+// load reads the job history from the store path
+func (m *Manager) load() error {
+	data, err := os.ReadFile(m.storePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Infof("job store %s doesn't exist, starting with empty job history", m.storePath)
+			return nil
+		}
+		return apierror.New(apierror.ErrInternalError, "failed to read job store", err)
+	}
+
+	jobs := make(map[string]*Job)
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to decode job store", err)
+	}
+
+	now := time.Now().UTC()
+	for _, j := range jobs {
+		if !j.Done() {
+			log.Warnf("marking job %s as interrupted", j.ID)
+			j.Status = StatusInterrupted
+			j.Error = "job was interrupted by a restart"
+			j.FinishedAt = &now
+		}
+	}
+
+	m.jobs = jobs
+	log.Infof("loaded %d jobs from %s", len(jobs), m.storePath)
+
+	return nil
+}
+
+func (j *Job) copy() *Job {
+	c := *j
+	c.Steps = make([]Step, len(j.Steps))
+	copy(c.Steps, j.Steps)
+	return &c
+}
+
+func errorMessage(err error) string {
+	if aerr, ok := errors.Cause(err).(apierror.Error); ok {
+		return aerr.Message
+	}
+	return err.Error()
+}
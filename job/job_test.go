@@ -0,0 +1,320 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitForJob(t *testing.T, m *Manager, id string) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("unexpected error getting job %s: %s", id, err)
+		}
+
+		if j.Done() {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("timeout waiting for job %s", id)
+	return nil
+}
+
+func TestStart(t *testing.T) {
+	m, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error creating manager: %s", err)
+	}
+
+	if _, err := m.Start(context.TODO(), "", "host", "object", nil); err == nil {
+		t.Error("expected error for invalid input, got nil")
+	}
+
+	j, err := m.Start(context.TODO(), "createclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		if err := tr.Step("one", func() error { return nil }); err != nil {
+			return nil, err
+		}
+		if err := tr.Step("two", func() error { return nil }); err != nil {
+			return nil, err
+		}
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	out := waitForJob(t, m, j.ID)
+	if out.Status != StatusSucceeded {
+		t.Errorf("expected status %s, got %s", StatusSucceeded, out.Status)
+	}
+
+	if len(out.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(out.Steps))
+	}
+
+	for i, name := range []string{"one", "two"} {
+		if out.Steps[i].Name != name || out.Steps[i].Status != StatusSucceeded {
+			t.Errorf("unexpected step %d: %+v", i, out.Steps[i])
+		}
+	}
+
+	if string(out.Output) != `"done"` {
+		t.Errorf("expected output \"done\", got %s", string(out.Output))
+	}
+
+	j, err = m.Start(context.TODO(), "deleteclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		return nil, tr.Step("boom", func() error { return errors.New("boom") })
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	out = waitForJob(t, m, j.ID)
+	if out.Status != StatusFailed || out.Error != "boom" {
+		t.Errorf("expected failed job with error boom, got %+v", out)
+	}
+
+	if len(out.Steps) != 1 || out.Steps[0].Status != StatusFailed || out.Steps[0].Error != "boom" {
+		t.Errorf("expected failed step, got %+v", out.Steps)
+	}
+
+	if l := m.List(); len(l) != 2 {
+		t.Errorf("expected 2 jobs, got %d", len(l))
+	}
+
+	if _, err := m.Get("missing"); err == nil {
+		t.Error("expected error getting missing job, got nil")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	m, err := New(WithStorePath(path))
+	if err != nil {
+		t.Fatalf("unexpected error creating manager: %s", err)
+	}
+
+	j, err := m.Start(context.TODO(), "createclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+	waitForJob(t, m, j.ID)
+
+	block := make(chan struct{})
+	running, err := m.Start(context.TODO(), "updateclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		<-block
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	restarted, err := New(WithStorePath(path))
+	if err != nil {
+		t.Fatalf("unexpected error loading manager: %s", err)
+	}
+
+	out, err := restarted.Get(j.ID)
+	if err != nil {
+		t.Fatalf("expected persisted job %s, got error %s", j.ID, err)
+	}
+
+	if out.Status != StatusSucceeded || string(out.Output) != `"done"` {
+		t.Errorf("unexpected persisted job %+v", out)
+	}
+
+	out, err = restarted.Get(running.ID)
+	if err != nil {
+		t.Fatalf("expected persisted job %s, got error %s", running.ID, err)
+	}
+
+	if out.Status != StatusInterrupted {
+		t.Errorf("expected running job to be interrupted after restart, got %s", out.Status)
+	}
+
+	close(block)
+	waitForJob(t, m, running.ID)
+}
+
+func TestPrune(t *testing.T) {
+	m, err := New(WithMaxJobs(2), WithRetention(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error creating manager: %s", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	m.jobs["expired"] = &Job{ID: "expired", Status: StatusSucceeded, CreatedAt: old, FinishedAt: &old}
+	m.jobs["finished"] = &Job{ID: "finished", Status: StatusFailed, CreatedAt: time.Now(), FinishedAt: &old}
+	now := time.Now()
+	m.jobs["recent"] = &Job{ID: "recent", Status: StatusSucceeded, CreatedAt: now, FinishedAt: &now}
+
+	m.mu.Lock()
+	m.prune()
+	m.mu.Unlock()
+
+	if _, ok := m.jobs["expired"]; ok {
+		t.Error("expected expired job to be pruned")
+	}
+
+	if len(m.jobs) >= 2 {
+		t.Errorf("expected jobs to be trimmed below max, got %d", len(m.jobs))
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error creating manager: %s", err)
+	}
+
+	if _, _, _, err := m.Subscribe("missing"); err == nil {
+		t.Error("expected error subscribing to missing job, got nil")
+	}
+
+	start := make(chan struct{})
+	j, err := m.Start(context.TODO(), "createclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		<-start
+		if err := tr.Step("upload certificate", func() error { return nil }); err != nil {
+			return nil, err
+		}
+		return nil, tr.Step("create profile", func() error { return errors.New("boom") })
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	snapshot, events, cancel, err := m.Subscribe(j.ID)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to job: %s", err)
+	}
+	defer cancel()
+
+	if snapshot.ID != j.ID {
+		t.Errorf("expected snapshot of job %s, got %s", j.ID, snapshot.ID)
+	}
+
+	close(start)
+
+	got := []string{}
+	for e := range events {
+		if e.JobID != j.ID {
+			t.Errorf("expected event for job %s, got %s", j.ID, e.JobID)
+		}
+
+		if e.Type == EventTypeStep {
+			got = append(got, e.Step.Name+" "+string(e.Status))
+		}
+
+		if e.Type == EventTypeJob && e.Status == StatusFailed && e.Error != "boom" {
+			t.Errorf("expected job failure event with error boom, got %+v", e)
+		}
+	}
+
+	expected := []string{
+		"upload certificate running",
+		"upload certificate succeeded",
+		"create profile running",
+		"create profile failed",
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected step events %v, got %v", expected, got)
+	}
+
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected step event %d to be %s, got %s", i, expected[i], got[i])
+		}
+	}
+
+	// subscribing to a finished job returns a closed channel
+	_, events, cancel, err = m.Subscribe(j.ID)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to finished job: %s", err)
+	}
+	defer cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("expected closed event channel for finished job")
+	}
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	m, err := New()
+	if err != nil {
+		t.Fatalf("unexpected error creating manager: %s", err)
+	}
+
+	start := make(chan struct{})
+	finish := make(chan struct{})
+	j, err := m.Start(context.TODO(), "createclientssl", "host", "object", func(ctx context.Context, tr *Tracker) (interface{}, error) {
+		<-start
+		for i := 0; i < subscriberBuffer; i++ {
+			if err := tr.Step(fmt.Sprintf("step %d", i), func() error { return nil }); err != nil {
+				return nil, err
+			}
+		}
+		<-finish
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error starting job: %s", err)
+	}
+
+	_, events, cancel, err := m.Subscribe(j.ID)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing to job: %s", err)
+	}
+	defer cancel()
+
+	// the subscriber doesn't read until it's been disconnected for falling behind
+	close(start)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		subscribed := len(m.subscribers[j.ID]) > 0
+		m.mu.Unlock()
+
+		if !subscribed {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the subscriber to be disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var last Event
+	count := 0
+	for e := range events {
+		last = e
+		count++
+	}
+	close(finish)
+
+	if last.Type != EventTypeReset {
+		t.Errorf("expected the last event to be a reset, got %+v", last)
+	}
+
+	if last.Status != StatusRunning {
+		t.Errorf("expected the reset event to have the job status %s, got %s", StatusRunning, last.Status)
+	}
+
+	if count != subscriberBuffer+1 {
+		t.Errorf("expected %d events, got %d", subscriberBuffer+1, count)
+	}
+}
@@ -0,0 +1,60 @@
+package job
+
+import (
+	"time"
+)
+
+// Tracker records the progress of the steps executed by a job
+type Tracker struct {
+	id      string
+	manager *Manager
+}
+
+// JobID returns the id of the tracked job
+func (t *Tracker) JobID() string {
+	return t.id
+}
+
+// Step records the execution of the named step, returning the error from f
+func (t *Tracker) Step(name string, f func() error) error {
+	index := t.start(name)
+	err := f()
+	t.finish(index, err)
+	return err
+}
+
+func (t *Tracker) start(name string) int {
+	index := -1
+	t.manager.update(t.id, func(j *Job) *Event {
+		step := Step{
+			Name:      name,
+			Status:    StatusRunning,
+			StartedAt: time.Now().UTC(),
+		}
+		j.Steps = append(j.Steps, step)
+		index = len(j.Steps) - 1
+		return &Event{Type: EventTypeStep, Status: step.Status, Step: &step, Time: step.StartedAt}
+	})
+	return index
+}
+
+func (t *Tracker) finish(index int, err error) {
+	t.manager.update(t.id, func(j *Job) *Event {
+		if index < 0 || index >= len(j.Steps) {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		s := &j.Steps[index]
+		s.FinishedAt = &now
+		if err != nil {
+			s.Status = StatusFailed
+			s.Error = errorMessage(err)
+		} else {
+			s.Status = StatusSucceeded
+		}
+
+		step := *s
+		return &Event{Type: EventTypeStep, Status: step.Status, Step: &step, Error: step.Error, Time: now}
+	})
+}
@@ -0,0 +1,96 @@
+package ltm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+// DeviceStatus is the software version and high availability state of an ltm
+type DeviceStatus struct {
+	Version       string `json:"version"`
+	Build         string `json:"build,omitempty"`
+	FailoverState string `json:"failoverState"`
+}
+
+// stats is the nested stats format returned by the ltm for sys/version, cm/failover-status, etc.
+type stats struct {
+	Entries map[string]struct {
+		NestedStats struct {
+			Entries map[string]struct {
+				Description string `json:"description"`
+			} `json:"entries"`
+		} `json:"nestedStats"`
+	} `json:"entries"`
+}
+
+// GetDeviceStatus gets the software version and failover state of the ltm
+func (l *LTM) GetDeviceStatus() (*DeviceStatus, error) {
+	version, err := l.getStats("sys/version", "Version", "Build")
+	if err != nil {
+		return nil, err
+	}
+
+	failover, err := l.getStats("cm/failover-status", "status")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &DeviceStatus{
+		Version:       version["Version"],
+		Build:         version["Build"],
+		FailoverState: failover["status"],
+	}
+
+	log.Debugf("got device status for %s: %+v", l.Host, status)
+
+	return status, nil
+}
+
+// getStats gets the descriptions of the given keys from a stats endpoint
+func (l *LTM) getStats(url string, keys ...string) (map[string]string, error) {
+	var out []byte
+	err := l.call(func(b *bigip.BigIP) (err error) {
+		out, err = b.APICall(&bigip.APIRequest{
+			Method:      "get",
+			URL:         url,
+			ContentType: "application/json",
+		})
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to get %s on %s", url, l.Host)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	descriptions, err := statsDescriptions(out, keys...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to parse %s from %s", url, l.Host)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	return descriptions, nil
+}
+
+// statsDescriptions returns the descriptions of the given keys from the first stats entry
+func statsDescriptions(data []byte, keys ...string) (map[string]string, error) {
+	s := stats{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+
+	descriptions := map[string]string{}
+	for _, e := range s.Entries {
+		for _, k := range keys {
+			if v, ok := e.NestedStats.Entries[k]; ok {
+				descriptions[k] = v.Description
+			}
+		}
+		break
+	}
+
+	return descriptions, nil
+}
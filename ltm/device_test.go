@@ -0,0 +1,37 @@
+package ltm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsDescriptions(t *testing.T) {
+	version := []byte(`{
+		"kind": "tm:sys:version:versionstats",
+		"entries": {
+			"https://localhost/mgmt/tm/sys/version/0": {
+				"nestedStats": {
+					"entries": {
+						"Build": {"description": "0.0.6"},
+						"Product": {"description": "BIG-IP"},
+						"Version": {"description": "15.1.2"}
+					}
+				}
+			}
+		}
+	}`)
+
+	out, err := statsDescriptions(version, "Version", "Build", "Missing")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	expected := map[string]string{"Version": "15.1.2", "Build": "0.0.6"}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("expected %v, got %v", expected, out)
+	}
+
+	if _, err := statsDescriptions([]byte("not json"), "Version"); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
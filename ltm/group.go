@@ -0,0 +1,291 @@
+package ltm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultActiveTTL is how long the active unit of a group is remembered
+	defaultActiveTTL = 30 * time.Second
+	// DefaultSyncTimeout is how long to wait for a group to be in sync after a config-sync
+	DefaultSyncTimeout = 30 * time.Second
+)
+
+// GroupMember is a unit of a host group
+type GroupMember struct {
+	Name    string
+	Service LTMIface
+}
+
+// Group is a group of ltm units, ie. an active/standby pair, that's used as a single ltm.  Writes
+// go to the active unit, found with the failover status, and reads go to any unit.  Reads that
+// decide what to write use ReadActive, since the other units may not have the latest changes.
+type Group struct {
+	Name      string
+	SyncGroup string
+	// AutoSync syncs the configuration to the sync group after changes
+	AutoSync bool
+	// SyncTimeout is how long to wait for the group to be in sync
+	SyncTimeout time.Duration
+
+	members          []GroupMember
+	activeTTL        time.Duration
+	syncPollInterval time.Duration
+
+	mu        sync.Mutex
+	active    *GroupMember
+	checkedAt time.Time
+}
+
+// NewGroup creates a host group with the members in order of preference for reads
+func NewGroup(name, syncGroup string, members []GroupMember) *Group {
+	return &Group{
+		Name:             name,
+		SyncGroup:        syncGroup,
+		SyncTimeout:      DefaultSyncTimeout,
+		members:          members,
+		activeTTL:        defaultActiveTTL,
+		syncPollInterval: defaultSyncPollInterval,
+	}
+}
+
+// Members returns the names of the units in the group
+func (g *Group) Members() []string {
+	names := make([]string, 0, len(g.members))
+	for _, m := range g.members {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// MemberServices returns the units in the group
+func (g *Group) MemberServices() []GroupMember {
+	return append([]GroupMember(nil), g.members...)
+}
+
+// Active returns the name of the active unit, finding it with the failover status of the members
+// if it isn't known
+func (g *Group) Active() (string, error) {
+	m, err := g.activeMember()
+	if err != nil {
+		return "", err
+	}
+	return m.Name, nil
+}
+
+// activeMember returns the active unit, it's remembered for the active TTL
+func (g *Group) activeMember() (*GroupMember, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.active != nil && time.Since(g.checkedAt) < g.activeTTL {
+		return g.active, nil
+	}
+
+	g.active = nil
+
+	problems := []string{}
+	for i := range g.members {
+		m := &g.members[i]
+
+		status, err := m.Service.GetDeviceStatus()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", m.Name, err))
+			continue
+		}
+
+		if strings.EqualFold(status.FailoverState, "active") {
+			log.Debugf("%s is the active unit of host group %s", m.Name, g.Name)
+
+			g.active = m
+			g.checkedAt = time.Now()
+			return m, nil
+		}
+
+		problems = append(problems, fmt.Sprintf("%s: %s", m.Name, status.FailoverState))
+	}
+
+	msg := fmt.Sprintf("no active unit in host group %s (%s)", g.Name, strings.Join(problems, ", "))
+	return nil, apierror.New(apierror.ErrServiceUnavailable, msg, nil)
+}
+
+// forgetActive discards the active unit after a write fails, so it's found again in case the
+// group failed over
+func (g *Group) forgetActive() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.active = nil
+}
+
+// write calls fn with the active unit
+func (g *Group) write(fn func(LTMIface) error) error {
+	m, err := g.activeMember()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(m.Service); err != nil {
+		g.forgetActive()
+		return err
+	}
+
+	return nil
+}
+
+// ReadActive calls fn with the active unit.  Unlike the other reads, it doesn't fall back to the
+// other units, so the result is always the state the next write changes.
+func (g *Group) ReadActive(fn func(LTMIface) error) error {
+	m, err := g.activeMember()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(m.Service); err != nil {
+		g.forgetActive()
+		return err
+	}
+
+	return nil
+}
+
+// read calls fn with each unit, starting with the active unit if it's known, until one succeeds
+func (g *Group) read(fn func(LTMIface) error) error {
+	g.mu.Lock()
+	members := make([]GroupMember, 0, len(g.members))
+	if g.active != nil {
+		members = append(members, *g.active)
+	}
+	for _, m := range g.members {
+		if g.active == nil || m.Name != g.active.Name {
+			members = append(members, m)
+		}
+	}
+	g.mu.Unlock()
+
+	var err error
+	for _, m := range members {
+		if err = fn(m.Service); err == nil {
+			return nil
+		}
+		log.Warnf("failed to read from %s in host group %s: %s", m.Name, g.Name, err)
+	}
+
+	return err
+}
+
+// ListClientSSLProfiles lists the client ssl profiles on any unit
+func (g *Group) ListClientSSLProfiles() (out []string, err error) {
+	err = g.read(func(l LTMIface) (err error) {
+		out, err = l.ListClientSSLProfiles()
+		return err
+	})
+	return out, err
+}
+
+// ListClientSSLProfileDetails lists the client ssl profiles with all of their settings on any unit
+func (g *Group) ListClientSSLProfileDetails() (out []bigip.ClientSSLProfile, err error) {
+	err = g.read(func(l LTMIface) (err error) {
+		out, err = l.ListClientSSLProfileDetails()
+		return err
+	})
+	return out, err
+}
+
+// ListCertificates lists the certificates installed on any unit
+func (g *Group) ListCertificates() (out []bigip.Certificate, err error) {
+	err = g.read(func(l LTMIface) (err error) {
+		out, err = l.ListCertificates()
+		return err
+	})
+	return out, err
+}
+
+// GetClientSSLProfile gets a client ssl profile from any unit
+func (g *Group) GetClientSSLProfile(name string) (out *bigip.ClientSSLProfile, err error) {
+	err = g.read(func(l LTMIface) (err error) {
+		out, err = l.GetClientSSLProfile(name)
+		return err
+	})
+	return out, err
+}
+
+// GetDeviceStatus gets the status of the active unit
+func (g *Group) GetDeviceStatus() (*DeviceStatus, error) {
+	m, err := g.activeMember()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Service.GetDeviceStatus()
+}
+
+// UploadFile uploads a file to the active unit
+func (g *Group) UploadFile(file, name string) error {
+	return g.write(func(l LTMIface) error {
+		return l.UploadFile(file, name)
+	})
+}
+
+// ImportKey imports a key on the active unit
+func (g *Group) ImportKey(name, thisYear string) error {
+	return g.write(func(l LTMIface) error {
+		return l.ImportKey(name, thisYear)
+	})
+}
+
+// ImportCertificate imports a certificate on the active unit
+func (g *Group) ImportCertificate(name, thisYear string) error {
+	return g.write(func(l LTMIface) error {
+		return l.ImportCertificate(name, thisYear)
+	})
+}
+
+// ModifyClientSSLProfile updates a client-ssl profile on the active unit
+func (g *Group) ModifyClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, thisYear string) error {
+	return g.write(func(l LTMIface) error {
+		return l.ModifyClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, thisYear)
+	})
+}
+
+// CreateClientSSLProfile creates a client-ssl profile on the active unit
+func (g *Group) CreateClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, thisYear string) error {
+	return g.write(func(l LTMIface) error {
+		return l.CreateClientSSLProfile(name, defaultsFrom, chain, cipherGroup, ciphers, thisYear)
+	})
+}
+
+// PatchClientSSLProfile patches a client-ssl profile on the active unit
+func (g *Group) PatchClientSSLProfile(name string, patch *ClientSSLProfilePatch) error {
+	return g.write(func(l LTMIface) error {
+		return l.PatchClientSSLProfile(name, patch)
+	})
+}
+
+// RemoveClientSSLProfile deletes a client-ssl profile on the active unit
+func (g *Group) RemoveClientSSLProfile(name string) error {
+	return g.write(func(l LTMIface) error {
+		return l.RemoveClientSSLProfile(name)
+	})
+}
+
+// RemoveKey removes a key on the active unit
+func (g *Group) RemoveKey(name string) error {
+	return g.write(func(l LTMIface) error {
+		return l.RemoveKey(name)
+	})
+}
+
+// RemoveCertificate removes a certificate on the active unit
+func (g *Group) RemoveCertificate(name string) error {
+	return g.write(func(l LTMIface) error {
+		return l.RemoveCertificate(name)
+	})
+}
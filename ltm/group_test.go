@@ -0,0 +1,133 @@
+package ltm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+)
+
+// fakeUnit is a unit of a host group, the methods that aren't used by the tests aren't implemented
+type fakeUnit struct {
+	LTMIface
+	state   string
+	readErr error
+	failOn  string
+	calls   []string
+}
+
+func (f *fakeUnit) GetDeviceStatus() (*DeviceStatus, error) {
+	f.calls = append(f.calls, "status")
+	return &DeviceStatus{Version: "15.1.2", FailoverState: f.state}, nil
+}
+
+func (f *fakeUnit) ListClientSSLProfiles() ([]string, error) {
+	f.calls = append(f.calls, "list")
+	if f.readErr != nil {
+		return nil, f.readErr
+	}
+	return []string{"www.example.org"}, nil
+}
+
+func (f *fakeUnit) UploadFile(file, name string) error {
+	f.calls = append(f.calls, "upload "+name)
+	if f.failOn == "upload" {
+		return errors.New("HTTP 503 :: unavailable")
+	}
+	return nil
+}
+
+func TestGroup(t *testing.T) {
+	ltm1 := &fakeUnit{state: "STANDBY"}
+	ltm2 := &fakeUnit{state: "ACTIVE"}
+
+	g := NewGroup("pair", "sync-failover", []GroupMember{{Name: "ltm1", Service: ltm1}, {Name: "ltm2", Service: ltm2}})
+
+	if !reflect.DeepEqual(g.Members(), []string{"ltm1", "ltm2"}) {
+		t.Errorf("unexpected members %v", g.Members())
+	}
+
+	// reads use the first member until the active unit is known
+	if _, err := g.ListClientSSLProfiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ltm1.calls, []string{"list"}) || len(ltm2.calls) != 0 {
+		t.Errorf("expected the read from ltm1, got %v and %v", ltm1.calls, ltm2.calls)
+	}
+
+	// writes go to the active unit
+	if err := g.UploadFile("data", "www.example.org.crt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if active, _ := g.Active(); active != "ltm2" {
+		t.Errorf("expected ltm2 to be active, got %s", active)
+	}
+
+	if ltm2.calls[len(ltm2.calls)-1] != "upload www.example.org.crt" {
+		t.Errorf("expected the upload on ltm2, got %v", ltm2.calls)
+	}
+
+	// reads prefer the active unit and fall back to the others
+	ltm1.calls, ltm2.calls = nil, nil
+	ltm2.readErr = errors.New("connection refused")
+	if _, err := g.ListClientSSLProfiles(); err != nil {
+		t.Errorf("expected the read to fall back to ltm1, got %s", err)
+	}
+
+	if !reflect.DeepEqual(ltm2.calls, []string{"list"}) || !reflect.DeepEqual(ltm1.calls, []string{"list"}) {
+		t.Errorf("expected reads from ltm2 then ltm1, got %v and %v", ltm2.calls, ltm1.calls)
+	}
+
+	// after a failover, a failed write finds the new active unit for the next write
+	ltm1.state, ltm2.state = "ACTIVE", "STANDBY"
+	ltm2.failOn = "upload"
+	if err := g.UploadFile("data", "one"); err == nil {
+		t.Error("expected the write to the old active unit to fail")
+	}
+
+	if err := g.UploadFile("data", "two"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ltm1.calls[len(ltm1.calls)-1] != "upload two" {
+		t.Errorf("expected the upload on ltm1, got %v", ltm1.calls)
+	}
+
+	// reads for writes only go to the active unit
+	ltm1.calls, ltm2.calls = nil, nil
+	err := g.ReadActive(func(l LTMIface) error {
+		_, err := l.ListClientSSLProfiles()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ltm1.calls, []string{"list"}) || len(ltm2.calls) != 0 {
+		t.Errorf("expected the read from ltm1, got %v and %v", ltm1.calls, ltm2.calls)
+	}
+
+	ltm1.readErr = errors.New("HTTP 404 :: not found")
+	ltm1.calls, ltm2.calls = nil, nil
+	err = g.ReadActive(func(l LTMIface) error {
+		_, err := l.ListClientSSLProfiles()
+		return err
+	})
+	if err == nil || len(ltm2.calls) != 0 {
+		t.Errorf("expected the read to fail without falling back, got %v, %v", err, ltm2.calls)
+	}
+
+	// writes fail without an active unit
+	ltm1.readErr = nil
+	ltm1.state = "OFFLINE"
+	g.forgetActive()
+	err = g.UploadFile("data", "three")
+
+	var aerr apierror.Error
+	if !errors.As(err, &aerr) || aerr.Code != apierror.ErrServiceUnavailable {
+		t.Errorf("expected service unavailable error, got %v", err)
+	}
+}
@@ -8,15 +8,22 @@ import (
 // LTMIface is abstraction for testing
 type LTMIface interface {
 	ListClientSSLProfiles() ([]string, error)
+	ListClientSSLProfileDetails() ([]bigip.ClientSSLProfile, error)
+	ListCertificates() ([]bigip.Certificate, error)
 	GetClientSSLProfile(string) (*bigip.ClientSSLProfile, error)
 	UploadFile(string, string) error
 	ImportKey(string, string) error
 	ImportCertificate(string, string) error
 	ModifyClientSSLProfile(string, string, string, string, string, string) error
 	CreateClientSSLProfile(string, string, string, string, string, string) error
+	PatchClientSSLProfile(string, *ClientSSLProfilePatch) error
 	RemoveClientSSLProfile(string) error
 	RemoveKey(string) error
 	RemoveCertificate(string) error
+	GetDeviceStatus() (*DeviceStatus, error)
+	SyncConfig(string) error
+	GetSyncStatus() (*SyncStatus, error)
+	SaveConfig() error
 }
 
 // LTM is struct containing login info
@@ -24,15 +31,48 @@ type LTM struct {
 	Service    *bigip.BigIP
 	UploadPath string
 	Host       string
+	// auth is set when the session uses token auth instead of basic auth
+	auth *tokenAuth
 }
 
-// NewSession creates a new LTM session
-func NewSession(host, user, pass, uploadPath string) *LTM {
+// Option configures an LTM session
+type Option func(*LTM)
+
+// WithTLSOptions sets how the ltm's certificate is verified.  If the options are invalid, the error
+// is logged and every connection to the ltm fails with it.
+func WithTLSOptions(opts TLSOptions) Option {
+	return func(l *LTM) {
+		config, err := NewTLSConfig(opts)
+		if err != nil {
+			log.Errorf("invalid tls configuration for ltm host %s, connections will fail: %s", l.Host, err)
+			config = failedTLSConfig(err)
+		}
+
+		if config.InsecureSkipVerify && config.VerifyConnection == nil {
+			log.Warnf("certificate verification is disabled for ltm host %s", l.Host)
+		}
+
+		l.transport().TLSClientConfig = config
+	}
+}
+
+// NewSession creates a new LTM session.  The ltm's certificate is verified against the system
+// roots unless other TLS options are given.
+func NewSession(host, user, pass, uploadPath string, opts ...Option) *LTM {
 	log.Infof("creating a new LTM session with host %s with username %s", host, user)
 
-	return &LTM{
+	l := &LTM{
 		Service:    bigip.NewSession(host, user, pass, nil),
 		UploadPath: uploadPath,
 		Host:       host,
 	}
+
+	// the bigip client skips verification by default, so it's always replaced
+	WithTLSOptions(TLSOptions{})(l)
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
 }
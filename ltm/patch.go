@@ -0,0 +1,179 @@
+package ltm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	bigip "github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+// tlsVersionOptions maps TLS protocol versions to the tmOptions which disable them
+var tlsVersionOptions = map[string]string{
+	"TLSv1":   "no-tlsv1",
+	"TLSv1.1": "no-tlsv1.1",
+	"TLSv1.2": "no-tlsv1.2",
+	"TLSv1.3": "no-tlsv1.3",
+}
+
+// ClientSSLProfilePatch is a partial update to a client-ssl profile, only the non-nil fields are changed
+type ClientSSLProfilePatch struct {
+	Cert          *string  `json:"cert,omitempty"`
+	Key           *string  `json:"key,omitempty"`
+	Chain         *string  `json:"chain,omitempty"`
+	DefaultsFrom  *string  `json:"defaultsFrom,omitempty"`
+	CipherGroup   *string  `json:"cipherGroup,omitempty"`
+	Ciphers       *string  `json:"ciphers,omitempty"`
+	Renegotiation *bool    `json:"renegotiation,omitempty"`
+	SessionTicket *bool    `json:"sessionTicket,omitempty"`
+	OCSPStapling  *bool    `json:"ocspStapling,omitempty"`
+	TLSVersions   []string `json:"tlsVersions,omitempty"`
+}
+
+// Empty returns true if the patch doesn't change anything
+func (p *ClientSSLProfilePatch) Empty() bool {
+	return p.Cert == nil && p.Key == nil && p.Chain == nil && p.DefaultsFrom == nil && p.CipherGroup == nil &&
+		p.Ciphers == nil && p.Renegotiation == nil && p.SessionTicket == nil && p.OCSPStapling == nil && p.TLSVersions == nil
+}
+
+// Validate checks the patch for unsupported values
+func (p *ClientSSLProfilePatch) Validate() error {
+	if p.Empty() {
+		return apierror.New(apierror.ErrBadRequest, "no client-ssl profile fields to update", nil)
+	}
+
+	if (p.Cert == nil) != (p.Key == nil) {
+		return apierror.New(apierror.ErrBadRequest, "cert and key must be updated together", nil)
+	}
+
+	if p.TLSVersions != nil && len(p.TLSVersions) == 0 {
+		return apierror.New(apierror.ErrBadRequest, "at least one TLS version must be enabled", nil)
+	}
+
+	for _, v := range p.TLSVersions {
+		if _, ok := tlsVersionOptions[v]; !ok {
+			return apierror.New(apierror.ErrBadRequest, fmt.Sprintf("unsupported TLS version %s", v), nil)
+		}
+	}
+
+	return nil
+}
+
+// PatchClientSSLProfile updates only the fields of a client-ssl profile set in the patch
+func (l *LTM) PatchClientSSLProfile(name string, patch *ClientSSLProfilePatch) error {
+	if name == "" || patch == nil {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	if err := patch.Validate(); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{}
+
+	strs := map[string]*string{
+		"cert":         patch.Cert,
+		"key":          patch.Key,
+		"chain":        patch.Chain,
+		"defaultsFrom": patch.DefaultsFrom,
+		"cipherGroup":  patch.CipherGroup,
+		"ciphers":      patch.Ciphers,
+	}
+	for k, v := range strs {
+		if v != nil {
+			body[k] = *v
+		}
+	}
+
+	toggles := map[string]*bool{
+		"renegotiation": patch.Renegotiation,
+		"sessionTicket": patch.SessionTicket,
+		"ocspStapling":  patch.OCSPStapling,
+	}
+	for k, v := range toggles {
+		if v != nil {
+			body[k] = enabled(*v)
+		}
+	}
+
+	if patch.TLSVersions != nil {
+		var current *bigip.ClientSSLProfile
+		err := l.call(func(b *bigip.BigIP) (err error) {
+			current, err = b.GetClientSSLProfile(name)
+			return err
+		})
+		if err != nil {
+			msg := fmt.Sprintf("failed to get ssl profile %s on %s", name, l.Host)
+			return apierror.New(apierror.ErrInternalError, msg, err)
+		}
+
+		if current == nil {
+			return apierror.New(apierror.ErrNotFound, fmt.Sprintf("%s not found", name), nil)
+		}
+
+		body["tmOptions"] = tlsVersionTmOptions(current.TmOptions, patch.TLSVersions)
+	}
+
+	j, err := json.Marshal(body)
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to marshal json", err)
+	}
+
+	log.Debugf("patching client-ssl profile %s on %s with %s", name, l.Host, string(j))
+
+	err = l.call(func(b *bigip.BigIP) error {
+		_, err := b.APICall(&bigip.APIRequest{
+			Method:      "patch",
+			URL:         fmt.Sprintf("ltm/profile/client-ssl/%s", name),
+			Body:        string(j),
+			ContentType: "application/json",
+		})
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to patch client-ssl profile %s on %s", name, l.Host)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	log.Infof("patched client-ssl profile %s on %s", name, l.Host)
+
+	return nil
+}
+
+// tlsVersionTmOptions returns the tmOptions which enable only the given TLS versions, keeping
+// any of the current options that aren't related to the TLS version
+func tlsVersionTmOptions(current, versions []string) []string {
+	allowed := map[string]bool{}
+	for _, v := range versions {
+		allowed[v] = true
+	}
+
+	versionOptions := map[string]bool{}
+	for _, o := range tlsVersionOptions {
+		versionOptions[o] = true
+	}
+
+	options := []string{}
+	for _, o := range current {
+		if o == "none" || versionOptions[o] {
+			continue
+		}
+		options = append(options, o)
+	}
+
+	for _, v := range []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"} {
+		if !allowed[v] {
+			options = append(options, tlsVersionOptions[v])
+		}
+	}
+
+	return options
+}
+
+func enabled(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,69 @@
+package ltm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTLSVersionTmOptions(t *testing.T) {
+	type test struct {
+		current  []string
+		versions []string
+		expected []string
+	}
+
+	tests := []test{
+		{
+			current:  []string{"dont-insert-empty-fragments", "no-tlsv1.3"},
+			versions: []string{"TLSv1.2", "TLSv1.3"},
+			expected: []string{"dont-insert-empty-fragments", "no-tlsv1", "no-tlsv1.1"},
+		},
+		{
+			current:  []string{"none"},
+			versions: []string{"TLSv1.2"},
+			expected: []string{"no-tlsv1", "no-tlsv1.1", "no-tlsv1.3"},
+		},
+		{
+			current:  nil,
+			versions: []string{"TLSv1", "TLSv1.1", "TLSv1.2", "TLSv1.3"},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range tests {
+		out := tlsVersionTmOptions(tc.current, tc.versions)
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Errorf("expected tmOptions %v for %v, got %v", tc.expected, tc.versions, out)
+		}
+	}
+}
+
+func TestClientSSLProfilePatchValidate(t *testing.T) {
+	s := "foo"
+	b := true
+
+	type test struct {
+		patch *ClientSSLProfilePatch
+		valid bool
+	}
+
+	tests := []test{
+		{patch: &ClientSSLProfilePatch{}, valid: false},
+		{patch: &ClientSSLProfilePatch{CipherGroup: &s}, valid: true},
+		{patch: &ClientSSLProfilePatch{Renegotiation: &b}, valid: true},
+		{patch: &ClientSSLProfilePatch{Cert: &s}, valid: false},
+		{patch: &ClientSSLProfilePatch{Cert: &s, Key: &s}, valid: true},
+		{patch: &ClientSSLProfilePatch{TLSVersions: []string{}}, valid: false},
+		{patch: &ClientSSLProfilePatch{TLSVersions: []string{"SSLv3"}}, valid: false},
+		{patch: &ClientSSLProfilePatch{TLSVersions: []string{"TLSv1.2", "TLSv1.3"}}, valid: true},
+	}
+
+	for _, tc := range tests {
+		err := tc.patch.Validate()
+		if tc.valid && err != nil {
+			t.Errorf("expected patch %+v to be valid, got %s", tc.patch, err)
+		} else if !tc.valid && err == nil {
+			t.Errorf("expected patch %+v to be invalid", tc.patch)
+		}
+	}
+}
@@ -10,7 +10,11 @@ import (
 
 // ListClientSSLProfiles lists the client ssl profiles
 func (l *LTM) ListClientSSLProfiles() ([]string, error) {
-	out, err := l.Service.ClientSSLProfiles()
+	var out *bigip.ClientSSLProfiles
+	err := l.call(func(b *bigip.BigIP) (err error) {
+		out, err = b.ClientSSLProfiles()
+		return err
+	})
 	if err != nil {
 		msg := fmt.Sprintf("failed to list client ssl profiles")
 		return nil, apierror.New(apierror.ErrInternalError, msg, err)
@@ -24,13 +28,55 @@ func (l *LTM) ListClientSSLProfiles() ([]string, error) {
 	return profiles, nil
 }
 
+// ListClientSSLProfileDetails lists the client ssl profiles with all of their settings
+func (l *LTM) ListClientSSLProfileDetails() ([]bigip.ClientSSLProfile, error) {
+	var out *bigip.ClientSSLProfiles
+	err := l.call(func(b *bigip.BigIP) (err error) {
+		out, err = b.ClientSSLProfiles()
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to list client ssl profiles on %s", l.Host)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	if out == nil {
+		return []bigip.ClientSSLProfile{}, nil
+	}
+
+	return out.ClientSSLProfiles, nil
+}
+
+// ListCertificates lists the certificates installed on the ltm
+func (l *LTM) ListCertificates() ([]bigip.Certificate, error) {
+	var out *bigip.Certificates
+	err := l.call(func(b *bigip.BigIP) (err error) {
+		out, err = b.Certificates()
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to list certificates on %s", l.Host)
+		return nil, apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	if out == nil {
+		return []bigip.Certificate{}, nil
+	}
+
+	return out.Certificates, nil
+}
+
 // GetClientSSLProfile gets a client ssl profile from ltm
 func (l *LTM) GetClientSSLProfile(name string) (*bigip.ClientSSLProfile, error) {
 	if name == "" {
 		return nil, apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	out, err := l.Service.GetClientSSLProfile(name)
+	var out *bigip.ClientSSLProfile
+	err := l.call(func(b *bigip.BigIP) (err error) {
+		out, err = b.GetClientSSLProfile(name)
+		return err
+	})
 	if err != nil {
 		msg := fmt.Sprintf("failed to get ssl profile %s on %s", name, l.Host)
 		return nil, apierror.New(apierror.ErrInternalError, msg, err)
@@ -45,7 +91,11 @@ func (l *LTM) UploadFile(file, name string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	if _, err := l.Service.UploadBytes([]byte(file), name); err != nil {
+	err := l.call(func(b *bigip.BigIP) error {
+		_, err := b.UploadBytes([]byte(file), name)
+		return err
+	})
+	if err != nil {
 		msg := fmt.Sprintf("failed to upload file %s on %s", name, l.Host)
 		return apierror.New(apierror.ErrInternalError, msg, err)
 	}
@@ -66,7 +116,9 @@ func (l *LTM) ImportCertificate(name, thisYear string) error {
 		SourcePath: fmt.Sprintf("file:%s/%s.crt", l.UploadPath, name),
 	}
 
-	err := l.Service.AddCertificate(addcert)
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.AddCertificate(addcert)
+	})
 	if err != nil {
 		// todo: button-up with more logic perhaps, make a call to cert/key
 		// api, and look to see if it exists first, but failing to 'add' isn't
@@ -94,7 +146,9 @@ func (l *LTM) ImportKey(name, thisYear string) error {
 		SourcePath: fmt.Sprintf("file:%s/%s.key", l.UploadPath, name),
 	}
 
-	err := l.Service.AddKey(addkey)
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.AddKey(addkey)
+	})
 	if err != nil {
 		// See AddCertificate comment above
 		log.Infof("add key error on host %s: %s, proceeding...", l.Host, err)
@@ -111,7 +165,9 @@ func (l *LTM) RemoveKey(name string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	err := l.Service.DeleteKey(name)
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.DeleteKey(name)
+	})
 	if err != nil {
 		// See AddCertificate comment above
 		log.Infof("delete key error on host %s: %s, proceeding...", l.Host, err)
@@ -128,7 +184,9 @@ func (l *LTM) RemoveCertificate(name string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	err := l.Service.DeleteCertificate(name)
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.DeleteCertificate(name)
+	})
 	if err != nil {
 		// See AddCertificate comment above
 		log.Infof("delete certificate error on host %s: %s, proceeding...", l.Host, err)
@@ -155,7 +213,10 @@ func (l *LTM) ModifyClientSSLProfile(ClientSSLProfileName, DefaultsFrom, Chain,
 		Ciphers:      Ciphers,
 	}
 
-	if err := l.Service.ModifyClientSSLProfile(ClientSSLProfileName, modifycert); err != nil {
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.ModifyClientSSLProfile(ClientSSLProfileName, modifycert)
+	})
+	if err != nil {
 		msg := fmt.Sprintf("failed to modify client-ssl profile %s on %s", ClientSSLProfileName, l.Host)
 		return apierror.New(apierror.ErrInternalError, msg, err)
 	}
@@ -182,7 +243,10 @@ func (l *LTM) CreateClientSSLProfile(ClientSSLProfileName, DefaultsFrom, Chain,
 		Ciphers:      Ciphers,
 	}
 
-	if err := l.Service.AddClientSSLProfile(addcert); err != nil {
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.AddClientSSLProfile(addcert)
+	})
+	if err != nil {
 		msg := fmt.Sprintf("error creating client-ssl profile %s on %s", ClientSSLProfileName, l.Host)
 		return apierror.New(apierror.ErrBadRequest, msg, err)
 	}
@@ -199,7 +263,10 @@ func (l *LTM) RemoveClientSSLProfile(ClientSSLProfileName string) error {
 		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
 	}
 
-	if err := l.Service.DeleteClientSSLProfile(ClientSSLProfileName); err != nil {
+	err := l.call(func(b *bigip.BigIP) error {
+		return b.DeleteClientSSLProfile(ClientSSLProfileName)
+	})
+	if err != nil {
 		msg := fmt.Sprintf("failed to delete client-ssl profile %s on %s", ClientSSLProfileName, l.Host)
 		return apierror.New(apierror.ErrInternalError, msg, err)
 	}
@@ -0,0 +1,50 @@
+package ltm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+// SaveConfig saves the running configuration of the ltm, like 'tmsh save sys config', so changes
+// made with the API aren't lost when the ltm restarts
+func (l *LTM) SaveConfig() error {
+	err := l.call(func(b *bigip.BigIP) error {
+		_, err := b.APICall(&bigip.APIRequest{
+			Method:      "post",
+			URL:         "sys/config",
+			Body:        `{"command":"save"}`,
+			ContentType: "application/json",
+		})
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to save the configuration of %s", l.Host)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	log.Infof("saved the configuration of %s", l.Host)
+
+	return nil
+}
+
+// SaveConfig saves the running configuration of every unit, since a sync changes the running
+// configuration of the other units as well
+func (g *Group) SaveConfig() error {
+	problems := []string{}
+	for _, m := range g.members {
+		if err := m.Service.SaveConfig(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", m.Name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		msg := fmt.Sprintf("failed to save the configuration of host group %s: %s", g.Name, strings.Join(problems, ", "))
+		return apierror.New(apierror.ErrInternalError, msg, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package ltm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SyncStatusInSync is the sync status of a device group with the same configuration on all devices
+	SyncStatusInSync = "In Sync"
+	// defaultSyncPollInterval is how often the sync status is checked while waiting for a sync
+	defaultSyncPollInterval = time.Second
+)
+
+// SyncStatus is the config-sync status of the device group an ltm belongs to
+type SyncStatus struct {
+	Status  string `json:"status"`
+	Summary string `json:"summary,omitempty"`
+	Color   string `json:"color,omitempty"`
+}
+
+// InSync returns true if the device group has the same configuration on all devices
+func (s *SyncStatus) InSync() bool {
+	return s != nil && s.Status == SyncStatusInSync
+}
+
+// syncCommand is the body of the request to run a config-sync
+type syncCommand struct {
+	Command     string `json:"command"`
+	UtilCmdArgs string `json:"utilCmdArgs"`
+}
+
+// SyncConfig syncs the configuration of the ltm to the other devices in the device group, the
+// sync runs in the background on the ltm
+func (l *LTM) SyncConfig(deviceGroup string) error {
+	if deviceGroup == "" {
+		return apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	j, err := json.Marshal(syncCommand{Command: "run", UtilCmdArgs: "config-sync to-group " + deviceGroup})
+	if err != nil {
+		return apierror.New(apierror.ErrInternalError, "failed to marshal json", err)
+	}
+
+	err = l.call(func(b *bigip.BigIP) error {
+		_, err := b.APICall(&bigip.APIRequest{
+			Method:      "post",
+			URL:         "cm",
+			Body:        string(j),
+			ContentType: "application/json",
+		})
+		return err
+	})
+	if err != nil {
+		msg := fmt.Sprintf("failed to sync %s to device group %s", l.Host, deviceGroup)
+		return apierror.New(apierror.ErrInternalError, msg, err)
+	}
+
+	log.Infof("started config-sync from %s to device group %s", l.Host, deviceGroup)
+
+	return nil
+}
+
+// GetSyncStatus gets the config-sync status of the ltm's device group
+func (l *LTM) GetSyncStatus() (*SyncStatus, error) {
+	out, err := l.getStats("cm/sync-status", "status", "summary", "color")
+	if err != nil {
+		return nil, err
+	}
+
+	return &SyncStatus{
+		Status:  out["status"],
+		Summary: out["summary"],
+		Color:   out["color"],
+	}, nil
+}
+
+// SyncConfig syncs the configuration of the active unit to the device group
+func (g *Group) SyncConfig(deviceGroup string) error {
+	return g.write(func(l LTMIface) error {
+		return l.SyncConfig(deviceGroup)
+	})
+}
+
+// GetSyncStatus gets the config-sync status from any unit
+func (g *Group) GetSyncStatus() (out *SyncStatus, err error) {
+	err = g.read(func(l LTMIface) (err error) {
+		out, err = l.GetSyncStatus()
+		return err
+	})
+	return out, err
+}
+
+// Sync syncs the configuration of the active unit to the group's sync group and waits for the
+// group to be in sync.  The last sync status is returned with the error if it isn't in sync
+// before the timeout.
+func (g *Group) Sync(ctx context.Context, timeout time.Duration) (*SyncStatus, error) {
+	if g.SyncGroup == "" {
+		msg := fmt.Sprintf("host group %s doesn't have a sync group", g.Name)
+		return nil, apierror.New(apierror.ErrBadRequest, msg, nil)
+	}
+
+	if err := g.SyncConfig(g.SyncGroup); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(g.syncPollInterval)
+	defer ticker.Stop()
+
+	var status *SyncStatus
+	for {
+		select {
+		case <-ctx.Done():
+			msg := fmt.Sprintf("host group %s isn't in sync after %s", g.Name, timeout)
+			if status != nil {
+				msg = fmt.Sprintf("%s, sync status is %s", msg, status.Status)
+			}
+			return status, apierror.New(apierror.ErrServiceUnavailable, msg, ctx.Err())
+		case <-ticker.C:
+		}
+
+		s, err := g.GetSyncStatus()
+		if err != nil {
+			log.Warnf("failed to get sync status of host group %s: %s", g.Name, err)
+			continue
+		}
+		status = s
+
+		log.Debugf("sync status of host group %s: %+v", g.Name, status)
+
+		if status.InSync() {
+			log.Infof("host group %s is in sync with device group %s", g.Name, g.SyncGroup)
+			return status, nil
+		}
+	}
+}
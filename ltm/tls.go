@@ -0,0 +1,151 @@
+package ltm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// TLSOptions are the settings for verifying the certificate of an ltm's management interface
+type TLSOptions struct {
+	// CAFile is a PEM encoded CA bundle used to verify the certificate, the system roots are used if it's empty
+	CAFile string
+	// PinnedSPKI is the base64 encoded SHA-256 digest of the certificate's public key.  Without a CA bundle,
+	// a certificate with the pinned key is trusted without verifying its chain or name.
+	PinnedSPKI string
+	// ServerName is the name the certificate is verified for, it defaults to the ltm host name
+	ServerName string
+	// InsecureSkipVerify disables certificate verification
+	InsecureSkipVerify bool
+}
+
+// PinError is returned when the ltm's certificate doesn't have the pinned public key
+type PinError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("certificate public key %s doesn't match the pinned key %s", e.Actual, e.Expected)
+}
+
+// SPKIFingerprint returns the base64 encoded SHA-256 digest of the certificate's public key
+func SPKIFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewTLSConfig returns the TLS configuration for connecting to an ltm.  Certificates are verified
+// against the system roots unless a CA bundle or pinned key is given, or verification is disabled.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opts.ServerName,
+	}
+
+	if opts.InsecureSkipVerify {
+		if opts.CAFile != "" || opts.PinnedSPKI != "" {
+			return nil, errors.New("certificate verification can't be disabled with a CA bundle or pinned key")
+		}
+
+		config.InsecureSkipVerify = true
+		return config, nil
+	}
+
+	if opts.CAFile != "" {
+		bundle, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %s", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("CA bundle %s doesn't contain any PEM encoded certificates", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.PinnedSPKI != "" {
+		pin, err := base64.StdEncoding.DecodeString(opts.PinnedSPKI)
+		if err != nil || len(pin) != sha256.Size {
+			return nil, errors.New("pinned key must be a base64 encoded SHA-256 digest")
+		}
+
+		// without a CA bundle, the pin replaces the chain and name verification so self-signed
+		// management certificates can be trusted
+		config.InsecureSkipVerify = opts.CAFile == ""
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return &PinError{Expected: opts.PinnedSPKI}
+			}
+
+			leaf := cs.PeerCertificates[0]
+			sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+			if !bytes.Equal(sum[:], pin) {
+				return &PinError{Expected: opts.PinnedSPKI, Actual: SPKIFingerprint(leaf)}
+			}
+
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// failedTLSConfig returns a TLS configuration that rejects every connection with err, it's used
+// when the TLS configuration can't be created so the session fails closed
+func failedTLSConfig(err error) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// the connection is always rejected by VerifyConnection
+		InsecureSkipVerify: true,
+		VerifyConnection: func(tls.ConnectionState) error {
+			return &tls.CertificateVerificationError{Err: err}
+		},
+	}
+}
+
+// CertificateError returns the certificate verification error from an ltm request error, or nil
+// if the request didn't fail because of the ltm's certificate
+func CertificateError(err error) error {
+	var verr *tls.CertificateVerificationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+
+	var perr *PinError
+	if errors.As(err, &perr) {
+		return perr
+	}
+
+	var uerr x509.UnknownAuthorityError
+	if errors.As(err, &uerr) {
+		return uerr
+	}
+
+	var herr x509.HostnameError
+	if errors.As(err, &herr) {
+		return herr
+	}
+
+	var cerr x509.CertificateInvalidError
+	if errors.As(err, &cerr) {
+		return cerr
+	}
+
+	return nil
+}
+
+// transport returns the http transport of the session, creating it if it's not set
+func (l *LTM) transport() *http.Transport {
+	if l.Service.Transport == nil {
+		l.Service.Transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	return l.Service.Transport
+}
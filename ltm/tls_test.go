@@ -0,0 +1,106 @@
+package ltm
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cert := srv.Certificate()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	emptyFile := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(emptyFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	pin := SPKIFingerprint(cert)
+	otherPin := "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	get := func(config *tls.Config) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	tests := []struct {
+		name      string
+		opts      TLSOptions
+		configErr bool
+		certErr   bool
+	}{
+		{name: "system roots", opts: TLSOptions{}, certErr: true},
+		{name: "ca file", opts: TLSOptions{CAFile: caFile}},
+		{name: "ca file wrong name", opts: TLSOptions{CAFile: caFile, ServerName: "ltm.example.org"}, certErr: true},
+		{name: "ca file and server name", opts: TLSOptions{CAFile: caFile, ServerName: "example.com"}},
+		{name: "pin", opts: TLSOptions{PinnedSPKI: pin}},
+		{name: "wrong pin", opts: TLSOptions{PinnedSPKI: otherPin}, certErr: true},
+		{name: "ca file and pin", opts: TLSOptions{CAFile: caFile, PinnedSPKI: pin}},
+		{name: "ca file and wrong pin", opts: TLSOptions{CAFile: caFile, PinnedSPKI: otherPin}, certErr: true},
+		{name: "insecure", opts: TLSOptions{InsecureSkipVerify: true}},
+		{name: "insecure and pin", opts: TLSOptions{InsecureSkipVerify: true, PinnedSPKI: pin}, configErr: true},
+		{name: "invalid pin", opts: TLSOptions{PinnedSPKI: "sha256/abc"}, configErr: true},
+		{name: "missing ca file", opts: TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, configErr: true},
+		{name: "empty ca file", opts: TLSOptions{CAFile: emptyFile}, configErr: true},
+	}
+
+	for _, test := range tests {
+		config, err := NewTLSConfig(test.opts)
+		if test.configErr {
+			if err == nil {
+				t.Errorf("%s: expected configuration error", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected nil configuration error, got %s", test.name, err)
+			continue
+		}
+
+		err = get(config)
+		if test.certErr {
+			if err == nil || CertificateError(err) == nil {
+				t.Errorf("%s: expected certificate error, got %v", test.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected nil error, got %s", test.name, err)
+		}
+	}
+}
+
+func TestNewSessionTLS(t *testing.T) {
+	l := NewSession("ltm.example.org", "api", "sekret", "/var/config/rest/downloads")
+	if c := l.Service.Transport.TLSClientConfig; c == nil || c.InsecureSkipVerify {
+		t.Errorf("expected certificates to be verified by default, got %+v", c)
+	}
+
+	// invalid options fail closed
+	l = NewSession("ltm.example.org", "api", "sekret", "", WithTLSOptions(TLSOptions{PinnedSPKI: "abc"}))
+
+	err := l.Service.Transport.TLSClientConfig.VerifyConnection(tls.ConnectionState{})
+	if err == nil || CertificateError(err) == nil || !strings.Contains(err.Error(), "pinned key") {
+		t.Errorf("expected connections to fail with the configuration error, got %v", err)
+	}
+}
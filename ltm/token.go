@@ -0,0 +1,219 @@
+package ltm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/YaleUniversity/go-bigip"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLoginProvider is the login provider for local ltm accounts
+	DefaultLoginProvider = "tmos"
+	// defaultTokenLifetime is the lifetime of an auth token if the ltm doesn't return one
+	defaultTokenLifetime = 20 * time.Minute
+	// tokenRefreshMargin is how long before an auth token expires that it's refreshed
+	tokenRefreshMargin = time.Minute
+	// loginTimeout is how long to wait for the ltm to respond to a login
+	loginTimeout = 30 * time.Second
+)
+
+// tokenAuth logs in to the ltm for an auth token and refreshes it before it expires.  The token
+// is shared by all of the requests to the ltm and only one login is in progress at a time.
+type tokenAuth struct {
+	mu       sync.RWMutex
+	loginMu  sync.Mutex
+	token    string
+	expires  time.Time
+	url      string
+	username string
+	password string
+	provider string
+	client   func() *http.Client
+	now      func() time.Time
+}
+
+// loginRequest is the body of a request to /mgmt/shared/authn/login
+type loginRequest struct {
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	LoginProviderName string `json:"loginProviderName"`
+}
+
+// loginResponse is the part of the response to /mgmt/shared/authn/login used to get the token
+type loginResponse struct {
+	Token struct {
+		Token            string `json:"token"`
+		Timeout          int64  `json:"timeout"`
+		ExpirationMicros int64  `json:"expirationMicros"`
+	} `json:"token"`
+}
+
+// WithTokenAuth authenticates to the ltm with an auth token from the login provider instead of
+// basic auth, which is required for remote (ie. RADIUS or LDAP) accounts.  The token is requested
+// on first use.
+func WithTokenAuth(loginProvider string) Option {
+	return func(l *LTM) {
+		if loginProvider == "" {
+			loginProvider = DefaultLoginProvider
+		}
+
+		log.Debugf("using token auth with login provider %s for ltm host %s", loginProvider, l.Host)
+
+		l.auth = &tokenAuth{
+			url:      baseURL(l.Host) + "/mgmt/shared/authn/login",
+			username: l.Service.User,
+			password: l.Service.Password,
+			provider: loginProvider,
+			client: func() *http.Client {
+				return &http.Client{Transport: l.transport(), Timeout: loginTimeout}
+			},
+			now: time.Now,
+		}
+	}
+}
+
+// baseURL returns the https url of the ltm host
+func baseURL(host string) string {
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return strings.TrimSuffix(host, "/")
+	}
+	return "https://" + strings.TrimSuffix(host, "/")
+}
+
+// get returns the current token, logging in if there isn't a token or it's about to expire
+func (a *tokenAuth) get() (string, error) {
+	if token, ok := a.current(); ok {
+		return token, nil
+	}
+
+	a.loginMu.Lock()
+	defer a.loginMu.Unlock()
+
+	// another request may have logged in while this one was waiting
+	if token, ok := a.current(); ok {
+		return token, nil
+	}
+
+	token, expires, err := a.login()
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	a.token = token
+	a.expires = expires
+	a.mu.Unlock()
+
+	return token, nil
+}
+
+// current returns the token if it's set and isn't about to expire
+func (a *tokenAuth) current() (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.token == "" || !a.now().Add(tokenRefreshMargin).Before(a.expires) {
+		return "", false
+	}
+
+	return a.token, true
+}
+
+// invalidate discards the token after the ltm rejects it, unless it's already been replaced
+func (a *tokenAuth) invalidate(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token == token {
+		a.token = ""
+	}
+}
+
+// login requests a new token from the ltm and returns it with its expiration time
+func (a *tokenAuth) login() (string, time.Time, error) {
+	body, err := json.Marshal(loginRequest{
+		Username:          a.username,
+		Password:          a.password,
+		LoginProviderName: a.provider,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	start := a.now()
+	resp, err := a.client().Post(a.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to log in as %s: %w", a.username, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read login response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("HTTP %d :: failed to log in as %s with login provider %s", resp.StatusCode, a.username, a.provider)
+	}
+
+	out := loginResponse{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode login response: %w", err)
+	}
+
+	if out.Token.Token == "" {
+		return "", time.Time{}, fmt.Errorf("login response for %s doesn't contain a token", a.username)
+	}
+
+	// the timeout is preferred to the expiration time, since it doesn't depend on the clocks matching
+	expires := start.Add(defaultTokenLifetime)
+	if out.Token.Timeout > 0 {
+		expires = start.Add(time.Duration(out.Token.Timeout) * time.Second)
+	} else if out.Token.ExpirationMicros > 0 {
+		expires = time.UnixMicro(out.Token.ExpirationMicros)
+	}
+
+	log.Infof("logged in to %s as %s with login provider %s, token expires at %s", a.url, a.username, a.provider, expires.UTC().Format(time.RFC3339))
+
+	return out.Token.Token, expires, nil
+}
+
+// isUnauthorized returns true if the bigip client error is an HTTP 401 response
+func isUnauthorized(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "HTTP 401 ")
+}
+
+// call calls fn with the bigip client.  With token auth, the client has the current token and the
+// call is retried once with a new token if the ltm rejects it.
+func (l *LTM) call(fn func(*bigip.BigIP) error) error {
+	if l.auth == nil {
+		return fn(l.Service)
+	}
+
+	for attempt := 1; ; attempt++ {
+		token, err := l.auth.get()
+		if err != nil {
+			return err
+		}
+
+		// each call gets its own copy of the client, so the shared token is never changed under it
+		service := *l.Service
+		service.Token = token
+
+		err = fn(&service)
+		if attempt > 1 || !isUnauthorized(err) {
+			return err
+		}
+
+		log.Warnf("auth token for %s was rejected, logging in again", l.Host)
+		l.auth.invalidate(token)
+	}
+}
@@ -0,0 +1,143 @@
+package ltm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YaleUniversity/go-bigip"
+)
+
+func TestTokenAuth(t *testing.T) {
+	var logins int32
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/mgmt/shared/authn/login" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		req := loginRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.Username != "api" || req.Password != "sekret" || req.LoginProviderName != "radius" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		n := atomic.AddInt32(&logins, 1)
+		fmt.Fprintf(w, `{"username": "api", "token": {"token": "token-%d", "timeout": 1200}}`, n)
+	}))
+	defer srv.Close()
+
+	l := NewSession(srv.URL, "api", "sekret", "", WithTLSOptions(TLSOptions{InsecureSkipVerify: true}), WithTokenAuth("radius"))
+
+	// concurrent requests share one login
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := l.call(func(b *bigip.BigIP) error {
+				if b.Token != "token-1" {
+					return fmt.Errorf("unexpected token %q", b.Token)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&logins); n != 1 {
+		t.Errorf("expected 1 login, got %d", n)
+	}
+
+	if l.Service.Token != "" {
+		t.Errorf("expected the shared client not to be changed, got token %q", l.Service.Token)
+	}
+
+	// a rejected token is replaced and the call is retried once
+	tokens := []string{}
+	err := l.call(func(b *bigip.BigIP) error {
+		tokens = append(tokens, b.Token)
+		if b.Token == "token-1" {
+			return errors.New("HTTP 401 :: Authentication failed")
+		}
+		return nil
+	})
+	if err != nil || strings.Join(tokens, ",") != "token-1,token-2" {
+		t.Errorf("expected a retry with a new token, got %v, %v", tokens, err)
+	}
+
+	err = l.call(func(b *bigip.BigIP) error {
+		return errors.New("HTTP 401 :: Authentication failed")
+	})
+	if !isUnauthorized(err) || atomic.LoadInt32(&logins) != 3 {
+		t.Errorf("expected the call to fail after one retry, got %v with %d logins", err, logins)
+	}
+
+	// other errors aren't retried
+	calls := 0
+	l.call(func(b *bigip.BigIP) error {
+		calls++
+		return errors.New("HTTP 404 :: not found")
+	})
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	// the token is refreshed before it expires
+	l.auth.now = func() time.Time { return time.Now().Add(19*time.Minute + 30*time.Second) }
+	l.call(func(b *bigip.BigIP) error {
+		if b.Token != "token-4" {
+			t.Errorf("expected a refreshed token, got %q", b.Token)
+		}
+		return nil
+	})
+
+	// login failures are returned without calling the ltm
+	l = NewSession(srv.URL, "api", "wrong", "", WithTLSOptions(TLSOptions{InsecureSkipVerify: true}), WithTokenAuth("radius"))
+	called := false
+	err = l.call(func(b *bigip.BigIP) error {
+		called = true
+		return nil
+	})
+	if err == nil || called || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("expected a login error, got %v (called %t)", err, called)
+	}
+
+	// basic auth sessions use the client as-is
+	l = NewSession(srv.URL, "api", "sekret", "")
+	l.call(func(b *bigip.BigIP) error {
+		if b != l.Service || b.Token != "" {
+			t.Error("expected the session's client without a token")
+		}
+		return nil
+	})
+}
+
+func TestBaseURL(t *testing.T) {
+	tests := map[string]string{
+		"ltm.example.org":          "https://ltm.example.org",
+		"ltm.example.org:8443":     "https://ltm.example.org:8443",
+		"https://ltm.example.org/": "https://ltm.example.org",
+	}
+
+	for host, expected := range tests {
+		if out := baseURL(host); out != expected {
+			t.Errorf("expected %s for %s, got %s", expected, host, out)
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/YaleSpinup/f5-api/api"
 	"github.com/YaleSpinup/f5-api/common"
@@ -42,8 +43,10 @@ var (
 	// Githash is the git sha of the built binary, it should be set at buildtime with ldflags
 	Githash = "No Git Commit Provided"
 
-	configFileName = flag.String("config", "config/config.json", "Configuration file.")
+	configFileName = flag.String("config", "config/config.json", "Configuration file, JSON or YAML.")
 	version        = flag.Bool("version", false, "Display version information and exit.")
+	validate       = flag.Bool("validate", false, "Validate the configuration, print a summary and exit.")
+	watch          = flag.Duration("watch", 10*time.Second, "How often to check the configuration file for changes, 0 disables watching.")
 )
 
 func main() {
@@ -58,15 +61,21 @@ func main() {
 	}
 	log.Infof("Starting f5-api version %s (%s)", Version, cwd)
 
-	config, err := common.ReadConfig(configReader())
+	config, err := loadConfig()
 	if err != nil {
+		if *validate {
+			fmt.Fprintf(os.Stderr, "Unable to read configuration: %s\n", err)
+			os.Exit(1)
+		}
 		log.Fatalf("Unable to read configuration from: %+v", err)
 	}
 
-	config.Version = common.Version{
-		Version:    Version,
-		BuildStamp: Buildstamp,
-		GitHash:    Githash,
+	if *validate {
+		validateConfig(config)
+	}
+
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
 	// Set the loglevel, info if it's unset
@@ -86,22 +95,57 @@ func main() {
 		go http.ListenAndServe("127.0.0.1:6080", nil)
 	}
 
-	// show the configuration in Debug but not password
-	log.Debugf(
-		"Reading configuration, ListenAddress: %s, Token: %s********, LogLevel: %s, Version: %s, Org: %s",
-		config.ListenAddress, config.Token[0:2], config.LogLevel, config.Version, config.Org)
-	for k, v := range config.Accounts {
-		log.Debugf(
-			"LTMHosts: %s, Username: %s, Password: %s********, UploadPath: %s",
-			k, v.Username, v.Password[0:2], v.UploadPath)
+	// show the configuration in Debug but not the secrets
+	log.Debugf("Reading configuration, Version: %s\n%s", config.Version, config.Summary())
+
+	// the configuration can't change when it's read from the environment, but it's still reloaded on SIGHUP
+	configFile := *configFileName
+	if os.Getenv("API_CONFIG") != "" {
+		configFile = ""
 	}
 
-	if err := api.NewServer(config); err != nil {
+	if err := api.NewServer(config, api.WithConfigReload(loadConfig, configFile, *watch)); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func configReader() io.Reader {
+// loadConfig reads the configuration and sets the version information, it's called at startup and
+// when the configuration is reloaded
+func loadConfig() (common.Config, error) {
+	r, format, err := configReader()
+	if err != nil {
+		return common.Config{}, err
+	}
+
+	config, err := common.ReadConfigFormat(r, format)
+	if err != nil {
+		return config, err
+	}
+
+	applied, err := config.ApplyEnv(os.Environ())
+	if err != nil {
+		return config, fmt.Errorf("unable to apply environment overrides: %s", err)
+	}
+
+	if len(applied) > 0 {
+		log.Infof("configuration settings overridden from the environment: %v", applied)
+	}
+
+	if err := config.SetRevision(); err != nil {
+		return config, err
+	}
+
+	config.Version = common.Version{
+		Version:    Version,
+		BuildStamp: Buildstamp,
+		GitHash:    Githash,
+	}
+
+	return config, nil
+}
+
+// configReader returns the configuration data and its format, the format is empty when it should be detected from the content
+func configReader() (io.Reader, string, error) {
 	if configEnv := os.Getenv("API_CONFIG"); configEnv != "" {
 		log.Infof("reading configuration from API_CONFIG environment")
 
@@ -111,22 +155,36 @@ func configReader() io.Reader {
 			c = []byte(configEnv)
 		}
 
-		return bytes.NewReader(c)
+		return bytes.NewReader(c), "", nil
 	}
 
 	log.Infof("reading configuration from %s", *configFileName)
 
 	configFile, err := os.Open(*configFileName)
 	if err != nil {
-		log.Fatalln("unable to open config file", err)
+		return nil, "", fmt.Errorf("unable to open config file: %s", err)
 	}
+	defer configFile.Close()
 
 	c, err := ioutil.ReadAll(configFile)
 	if err != nil {
-		log.Fatalln("unable to read config file", err)
+		return nil, "", fmt.Errorf("unable to read config file: %s", err)
 	}
 
-	return bytes.NewReader(c)
+	return bytes.NewReader(c), common.ConfigFormat(*configFileName), nil
+}
+
+// validateConfig prints the redacted configuration summary and any problems with the configuration, and exits
+func validateConfig(config common.Config) {
+	fmt.Print(config.Summary())
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Configuration %s is valid\n", config.Revision)
+	os.Exit(0)
 }
 
 func vers() {
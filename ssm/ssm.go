@@ -0,0 +1,68 @@
+package ssm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	log "github.com/sirupsen/logrus"
+)
+
+type SSM struct {
+	session *session.Session
+	Service ssmiface.SSMAPI
+}
+
+type SSMOption func(*SSM)
+
+func New(opts ...SSMOption) SSM {
+	s := SSM{}
+
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	if s.session != nil {
+		s.Service = ssm.New(s.session)
+	}
+
+	return s
+}
+
+func WithSession(sess *session.Session) SSMOption {
+	return func(s *SSM) {
+		log.Debug("using aws session")
+		s.session = sess
+	}
+}
+
+// GetParameter returns the decrypted value of the parameter
+func (s *SSM) GetParameter(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", apierror.New(apierror.ErrBadRequest, "invalid input", nil)
+	}
+
+	log.Infof("getting ssm parameter %s", name)
+
+	out, err := s.Service.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ssm.ErrCodeParameterNotFound {
+			return "", apierror.New(apierror.ErrNotFound, fmt.Sprintf("ssm parameter %s not found", name), err)
+		}
+		return "", apierror.New(apierror.ErrInternalError, fmt.Sprintf("failed to get ssm parameter %s", name), err)
+	}
+
+	if out.Parameter == nil {
+		return "", apierror.New(apierror.ErrNotFound, fmt.Sprintf("ssm parameter %s not found", name), nil)
+	}
+
+	return aws.StringValue(out.Parameter.Value), nil
+}
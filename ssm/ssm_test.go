@@ -0,0 +1,90 @@
+package ssm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/YaleSpinup/apierror"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/pkg/errors"
+)
+
+// mockSSMClient is a fake ssm client
+type mockSSMClient struct {
+	ssmiface.SSMAPI
+	t      *testing.T
+	params map[string]string
+	err    error
+}
+
+func newMockSSMClient(t *testing.T, params map[string]string, err error) ssmiface.SSMAPI {
+	return &mockSSMClient{
+		t:      t,
+		params: params,
+		err:    err,
+	}
+}
+
+func (m *mockSSMClient) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if !aws.BoolValue(input.WithDecryption) {
+		m.t.Error("expected parameter to be decrypted")
+	}
+
+	v, ok := m.params[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "not found", nil)
+	}
+
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(v)},
+	}, nil
+}
+
+func TestNewSession(t *testing.T) {
+	client := New()
+	to := reflect.TypeOf(client).String()
+	if to != "ssm.SSM" {
+		t.Errorf("expected type to be 'ssm.SSM', got %s", to)
+	}
+}
+
+func TestGetParameter(t *testing.T) {
+	s := SSM{Service: newMockSSMClient(t, map[string]string{"/f5-api/ltm1/password": "sekret"}, nil)}
+
+	out, err := s.GetParameter(context.TODO(), "/f5-api/ltm1/password")
+	if err != nil {
+		t.Fatalf("expected nil error, got %s", err)
+	}
+
+	if out != "sekret" {
+		t.Errorf("expected sekret, got %s", out)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		code string
+	}{
+		{"", nil, apierror.ErrBadRequest},
+		{"/f5-api/missing", nil, apierror.ErrNotFound},
+		{"/f5-api/ltm1/password", errors.New("boom"), apierror.ErrInternalError},
+	}
+
+	for _, test := range tests {
+		s.Service = newMockSSMClient(t, map[string]string{"/f5-api/ltm1/password": "sekret"}, test.err)
+
+		_, err := s.GetParameter(context.TODO(), test.name)
+		if aerr, ok := errors.Cause(err).(apierror.Error); !ok || aerr.Code != test.code {
+			t.Errorf("expected %s error for %q, got %v", test.code, test.name, err)
+		}
+	}
+}